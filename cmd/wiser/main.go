@@ -1,31 +1,129 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/read-talk/wiser/dao"
 	"github.com/read-talk/wiser/logic"
+	"strconv"
+	"strings"
 )
 
 var (
 	x                              string
+	input                          string
+	format                         string
+	titleKey                       string
+	bodyKey                        string
 	q                              string
 	m                              int
+	backend                        string
+	dsn                            string
+	path                           string
+	c                              string
+	analyzer                       string
+	dictionary                     string
+	n                              int
+	wikiFields                     bool
+	namespaces                     string
+	migrate                        bool
+	del                            string
+	compact                        bool
+	p                              bool
+	scorer                         string
+	k1                             float64
+	b                              float64
+	limit                          int
+	page                           int
 	DefaultIiBufferUpdateThreshold = 2048
 )
 
 func init() {
-	flag.StringVar(&x, "x", "", "wikipedia dump xml path for indexing")
+	flag.StringVar(&x, "x", "", "wikipedia dump xml path for indexing, may be .bz2 or .gz, - for stdin")
+	flag.StringVar(&input, "i", "", "documents for indexing: json lines, csv, tsv or html file, or directory of .txt/.md files, - for stdin")
+	flag.StringVar(&format, "format", "", "format of documents: jsonl, csv, tsv, html or dir, detected from the path if empty")
+	flag.StringVar(&titleKey, "title-key", logic.DefaultTitleKey, "field or column name of document titles")
+	flag.StringVar(&bodyKey, "body-key", logic.DefaultBodyKey, "field or column name of document bodies")
 	flag.StringVar(&q, "q", "", "query for search")
 	flag.IntVar(&m, "m", 10, "max count for indexing document")
+	flag.BoolVar(&wikiFields, "wiki-fields", false, "record section headings and links of wiki pages as metadata")
+	flag.StringVar(&namespaces, "ns", "0", "comma separated namespaces of wiki pages to index")
+	flag.StringVar(&backend, "backend", "file", "storage backend: file, mysql or memory")
+	flag.StringVar(&dsn, "dsn", dao.DefaultMySQLDSN, "mysql data source name")
+	flag.StringVar(&path, "path", "wiser.db", "index file path for the file backend")
+	flag.StringVar(&c, "c", "vbyte", "compress method for new index: vbyte, golomb or none; only vbyte stores skip data")
+	flag.StringVar(&analyzer, "analyzer", logic.AnalyzerNgram2, "analyzer for new index: ngram2, ngram (without normalization), mixed or dict")
+	flag.StringVar(&dictionary, "dict", "", "dictionary file for the dict analyzer")
+	flag.IntVar(&n, "n", logic.NGram, "length of n-gram tokens for new index")
+	flag.BoolVar(&p, "p", false, "enable phrase search")
+	flag.StringVar(&scorer, "scorer", "tfidf", "scoring method: tfidf or bm25")
+	flag.Float64Var(&k1, "k1", logic.DefaultBM25K1, "k1 parameter for bm25")
+	flag.Float64Var(&b, "b", logic.DefaultBM25B, "b parameter for bm25")
+	flag.IntVar(&limit, "limit", 10, "max count of search results per page, 0 for all")
+	flag.IntVar(&page, "page", 1, "page number of search results")
+	flag.StringVar(&del, "delete", "", "title of the document to delete")
+	flag.BoolVar(&compact, "compact", false, "purge deleted documents from postings and reclaim space in the file store")
+	flag.BoolVar(&migrate, "migrate", false, "rewrite JSON postings into the binary format")
 }
 
 func main() {
 	flag.Parse()
+	// 连接存储后端
+	store, err := openStore()
+	if err != nil {
+		fmt.Println("failed to open store, err: ", err)
+		return
+	}
+	defer store.Close()
+
 	// 初始化全局环境
-	env := logic.NewEnv(DefaultIiBufferUpdateThreshold)
+	env := logic.NewEnv(store, DefaultIiBufferUpdateThreshold)
+	env.Compress, err = logic.ParseCompressMethod(c)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if n < 1 {
+		fmt.Println("n must be greater than 0")
+		return
+	}
+	env.TokenLen = n
+	env.RecordWikiFields = wikiFields
+	env.WikiNamespaces, err = parseNamespaces(namespaces)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	env.DictionaryPath = dictionary
+	env.Analyzer, err = logic.NewAnalyzer(analyzer, env.TokenLen, dictionary)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if p {
+		env.EnablePharseSearch = 1
+	}
+	switch scorer {
+	case "tfidf":
+		env.Scorer = logic.TfIdfScorer{}
+	case "bm25":
+		env.Scorer = &logic.BM25Scorer{K1: k1, B: b}
+	default:
+		fmt.Printf("unknown scorer: %s\n", scorer)
+		return
+	}
+
+	// 将旧格式的倒排列表改写为二进制格式
+	if migrate {
+		n, err := env.MigratePostings()
+		if err != nil {
+			fmt.Println("failed to migrate postings, err: ", err)
+			return
+		}
+		fmt.Printf("%d postings migrated\n", n)
+	}
 
-	var err error
 	// 加载wiki的词条数据
 	if x != "" {
 		fmt.Println("需要构建索引的文件: ", x)
@@ -37,14 +135,102 @@ func main() {
 		}
 	}
 
+	// 导入其他格式的文档
+	if input != "" {
+		fmt.Println("需要构建索引的文档: ", input)
+		err = loadDocuments(env)
+		if err != nil {
+			fmt.Println("failed to load documents, err: ", err)
+			return
+		}
+	}
+
+	// 删除文档
+	if del != "" {
+		err = env.DeleteDocumentByTitle(del)
+		if err != nil {
+			fmt.Println("failed to delete document, err: ", err)
+			return
+		}
+		fmt.Printf("document %s deleted\n", del)
+	}
+
+	// 从倒排列表中清除已删除的文档
+	if compact {
+		n, err := env.Compact()
+		if err != nil {
+			fmt.Println("failed to compact, err: ", err)
+			return
+		}
+		fmt.Printf("%d documents purged\n", n)
+	}
+
 	// 进行检索
 	if q != "" {
 		fmt.Println("查询: ", q)
-		env.IndexedCount, err = dao.GetDocumentCount()
+		if page < 1 {
+			fmt.Println("page must be greater than 0")
+			return
+		}
+		opts := &logic.SearchOptions{Limit: limit, Offset: (page - 1) * limit}
+		hits, stats, err := env.Search(context.Background(), q, opts)
 		if err != nil {
 			fmt.Println("failed to query, err: ", err)
 			return
 		}
-		env.Search(q)
+		printHits(hits, stats)
+	}
+}
+
+// 输出检索结果的文档编号、标题和得分
+func printHits(hits []logic.Hit, stats logic.SearchStats) {
+	for _, h := range hits {
+		fmt.Printf("document_id: %d title: %s score: %.2f\n", h.DocumentID, h.Title, h.Score)
+	}
+	if stats.TotalHitsExact {
+		fmt.Printf("Total %d document are found! (%v)\n", stats.TotalHits, stats.Took)
+	} else {
+		fmt.Printf("Total at least %d document are found! (%v)\n", stats.TotalHits, stats.Took)
+	}
+}
+
+// 将 -i 指定的文档添加到索引中
+func loadDocuments(env *logic.WiserEnv) error {
+	src, err := logic.OpenDocumentSource(input, format, titleKey, bodyKey)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return env.LoadDocuments(src, m)
+}
+
+// 解析以逗号分隔的名字空间
+func parseNamespaces(s string) ([]int, error) {
+	var ret []int
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		ns, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace: %s", f)
+		}
+		ret = append(ret, ns)
+	}
+	return ret, nil
+}
+
+// 根据命令行参数打开存储后端
+func openStore() (dao.Store, error) {
+	switch backend {
+	case "file":
+		return dao.NewFileStore(path)
+	case "mysql":
+		return dao.NewMySQLStore(dsn)
+	case "memory":
+		return dao.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown backend: %s", backend)
 	}
 }
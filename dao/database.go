@@ -1,21 +1,92 @@
 package dao
 
+// 存储后端，负责管理文档、词元、倒排列表以及设置项
+// 通过实现该接口可以为 wiser 接入不同的存储（例如 MySQL）
+type Store interface {
+	// 根据文档标题获取文档编号，文档不存在时返回 0
+	// 已标记为删除但尚未清除的文档也会返回其编号
+	GetDocumentID(title string) (int, error)
+	// 根据文档编号获取文档标题
+	GetDocumentTitle(id int) (string, error)
+	// 根据文档编号获取文档正文
+	GetDocumentBody(id int) (string, error)
+	// 将新文档插入到 documents 表中
+	InsertDocument(title, body string) error
+	// 更新指定文档的正文
+	UpdateDocument(id int, body string) error
+	// 获取已存储的文档总数，不包括已标记为删除的文档
+	GetDocumentCount() (int, error)
+	// 将文档标记为删除，文档的数据在清除之前依然保留
+	DeleteDocument(id int) error
+	// 文档是否已标记为删除
+	IsDocumentDeleted(id int) (bool, error)
+	// 获取所有已标记为删除的文档编号，按升序排列
+	GetDeletedDocumentIDs() ([]int, error)
+	// 清除已标记为删除的文档，之后其标题可以再次使用
+	PurgeDocument(id int) error
+	// 获取文档的长度（词元数）
+	GetDocumentLength(id int) (int, error)
+	// 更新文档的长度（词元数）
+	UpdateDocumentLength(id, length int) error
+	// 获取文档的元数据（例如来源的路径、章节标题），没有元数据时返回空的 map
+	GetDocumentMetadata(id int) (map[string]string, error)
+	// 设置文档的一项元数据，value 为空字符串时删除该项
+	UpdateDocumentMetadata(id int, key, value string) error
+	// 获取别名指向的文档标题，别名不存在时返回空字符串
+	GetAliasTarget(alias string) (string, error)
+	// 将别名指向文档标题，target 为空字符串时删除别名
+	ReplaceAlias(alias, target string) error
+
+	// 获取词元编号和出现过该词元的文档数，词元不存在时编号为 0
+	GetTokenID(token string) (int, int, error)
+	// 根据词元编号获取词元
+	GetToken(id int) (string, error)
+	// 将词元存储到 tokens 表中，词元已存在时什么也不做
+	StoreToken(token string, postings []byte) error
+	// 获取所有词元的编号，按升序排列
+	GetTokenIDs() ([]int, error)
+
+	// 获取词元对应的文档数和倒排列表，倒排列表不存在时返回 nil
+	GetPostings(id int) (int, []byte, error)
+	// 更新词元对应的文档数
+	UpdateDocsCount(id, count int) error
+	// 更新词元对应的文档数、词元在单个文档中的最大出现次数和倒排列表
+	UpdatePostings(id, count, maxTermFrequency int, postings []byte) error
+	// 获取词元在单个文档中的最大出现次数，用于估计得分的上限，未记录时返回 0
+	GetTokenMaxTermFrequency(id int) (int, error)
+
+	// 获取设置项的值，设置项不存在时返回空字符串
+	GetSettings(key string) (string, error)
+	// 写入设置项，已存在时覆盖
+	ReplaceSettings(key, value string) error
+
+	// 关闭存储，释放占用的资源
+	Close() error
+}
+
+// 可以回收空间的存储后端
+// 只追加写入的存储在更新和删除之后依然保留旧的数据，Compact 将其清除
+type Compacter interface {
+	Compact() error
+}
+
 // 根据指定的文档标题获取文档编号
 // title 文档标题
 // 返回文档编号
-func DBGetDocumentID(title string) int {
-	id, _ := GetDocumentId(title)
-	return id
+func DBGetDocumentID(s Store, title string) (int, error) {
+	return s.GetDocumentID(title)
 }
 
 // 将文档添加到 documents 表中
 // title 文档标题
 // body 文档正文
-func DBAddDocument(title, body string) {
-	id := DBGetDocumentID(title)
+func DBAddDocument(s Store, title, body string) error {
+	id, err := DBGetDocumentID(s, title)
+	if err != nil {
+		return err
+	}
 	if id != 0 {
-		UpdateDocument(id, body)
-	} else {
-		InsertDocument(title, body)
+		return s.UpdateDocument(id, body)
 	}
+	return s.InsertDocument(title, body)
 }
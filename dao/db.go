@@ -3,33 +3,54 @@ package dao
 import (
 	"database/sql"
 	"fmt"
+
 	_ "github.com/go-sql-driver/mysql"
-	"os"
 )
 
-var db *sql.DB
+// MySQL 的默认连接串
+const DefaultMySQLDSN = "root:root1234@tcp(127.0.0.1:3306)/wiser?charset=utf8mb4"
+
+var _ Store = (*MySQLStore)(nil)
+
+// 使用 MySQL 作为存储后端
+type MySQLStore struct {
+	db *sql.DB
+}
 
-func init() {
-	db, _ = sql.Open("mysql", "root:root1234@tcp(127.0.0.1:3306)/wiser?charset=utf8mb4")
+// 连接 MySQL 并创建存储后端，不存在的元数据和别名的表会被创建
+// 其他的表需要先执行 doc/db.sql 创建
+// dsn 数据源名称，例如 DefaultMySQLDSN
+func NewMySQLStore(dsn string) (*MySQLStore, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
 	db.SetMaxOpenConns(1000)
-	err := db.Ping()
+	err = db.Ping()
 	if err != nil {
-		fmt.Println("failed to connect to mysql, err: ", err.Error())
-		os.Exit(1) // 退出程序
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to mysql: %w", err)
 	}
+	s := &MySQLStore{db: db}
+	// 按旧版的 doc/db.sql 建立的数据库中没有元数据和别名的表
+	for _, create := range []func() error{s.CreateTableWithDocumentMetadata, s.CreateTableWithAliases} {
+		err = create()
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
 
-	// 初始化数据库
-
-	//exitIfError(CreateTableWithSettings())
-	//exitIfError(CreateTableWithDocuments())
-	//exitIfError(CreateTableWithTokens())
-	//exitIfError(CreateUniqueIndexBetweenTokenIndexAndTokens())
-	//exitIfError(CreateUniqueIndexBetweenTitleIndexAndDocuments())
+// 关闭数据库连接
+func (s *MySQLStore) Close() error {
+	return s.db.Close()
 }
 
 // ModifyDB 操作数据库
-func ModifyDB(sql string, args ...interface{}) (int64, error) {
-	result, err := db.Exec(sql, args...)
+func (s *MySQLStore) ModifyDB(sql string, args ...interface{}) (int64, error) {
+	result, err := s.db.Exec(sql, args...)
 	if err != nil {
 		fmt.Println("failed to modify db, err: ", err.Error())
 		return 0, err
@@ -42,53 +63,69 @@ func ModifyDB(sql string, args ...interface{}) (int64, error) {
 	return count, nil
 }
 
-func CreateTableWithSettings() (err error) {
-	sqlStr := `CREATE TABLE IF NOT EXISTS settings (
-				  id INT(4) PRIMARY KEY AUTO_INCREMENT NOT NULL,
-                  key   TEXT,
-                  value TEXT
-               )`
-	_, err = ModifyDB(sqlStr)
+func (s *MySQLStore) CreateTableWithSettings() (err error) {
+	// key 和 value 是 MySQL 的保留字，需要用反引号括起来
+	sqlStr := "CREATE TABLE IF NOT EXISTS settings (" +
+		"id INT(4) PRIMARY KEY AUTO_INCREMENT NOT NULL, " +
+		"`key` TEXT, " +
+		"`value` TEXT)"
+	_, err = s.ModifyDB(sqlStr)
 	return
 }
 
-func CreateTableWithDocuments() (err error) {
+func (s *MySQLStore) CreateTableWithDocuments() (err error) {
 	sqlStr := `CREATE TABLE IF NOT EXISTS documents (
 				  id INT(4) PRIMARY KEY AUTO_INCREMENT NOT NULL,
 				  title   TEXT NOT NULL,
-                  body    TEXT NOT NULL
+                  body    TEXT NOT NULL,
+                  token_count INT NOT NULL DEFAULT 0,
+                  deleted     TINYINT NOT NULL DEFAULT 0
 				)`
-	_, err = ModifyDB(sqlStr)
+	_, err = s.ModifyDB(sqlStr)
 	return
 }
 
-func CreateTableWithTokens() (err error) {
+func (s *MySQLStore) CreateTableWithDocumentMetadata() (err error) {
+	sqlStr := "CREATE TABLE IF NOT EXISTS document_metadata (" +
+		"id INT(4) PRIMARY KEY AUTO_INCREMENT NOT NULL, " +
+		"document_id INT NOT NULL, " +
+		"`key` VARCHAR(255) NOT NULL, " +
+		"`value` MEDIUMTEXT NOT NULL, " +
+		"UNIQUE KEY document_key_index (document_id, `key`))"
+	_, err = s.ModifyDB(sqlStr)
+	return
+}
+
+func (s *MySQLStore) CreateTableWithAliases() (err error) {
+	sqlStr := "CREATE TABLE IF NOT EXISTS aliases (" +
+		"id INT(4) PRIMARY KEY AUTO_INCREMENT NOT NULL, " +
+		"alias  VARCHAR(255) NOT NULL, " +
+		"target TEXT NOT NULL, " +
+		"UNIQUE KEY alias_index (alias))"
+	_, err = s.ModifyDB(sqlStr)
+	return
+}
+
+func (s *MySQLStore) CreateTableWithTokens() (err error) {
 	sqlStr := `CREATE TABLE IF NOT EXISTS tokens (
 				  id INT(4) PRIMARY KEY AUTO_INCREMENT NOT NULL,
                   token      TEXT NOT NULL,
                   docs_count INT NOT NULL,
+                  max_tf     INT NOT NULL DEFAULT 0,
                   postings   BLOB NOT NULL
                )`
-	_, err = ModifyDB(sqlStr)
+	_, err = s.ModifyDB(sqlStr)
 	return
 }
 
-func CreateUniqueIndexBetweenTokenIndexAndTokens() (err error) {
+func (s *MySQLStore) CreateUniqueIndexBetweenTokenIndexAndTokens() (err error) {
 	sqlStr := "CREATE UNIQUE INDEX token_index ON tokens(token);"
-	_, err = ModifyDB(sqlStr)
+	_, err = s.ModifyDB(sqlStr)
 	return
 }
 
-func CreateUniqueIndexBetweenTitleIndexAndDocuments() (err error) {
+func (s *MySQLStore) CreateUniqueIndexBetweenTitleIndexAndDocuments() (err error) {
 	sqlStr := "CREATE UNIQUE INDEX title_index ON documents(title);"
-	_, err = ModifyDB(sqlStr)
+	_, err = s.ModifyDB(sqlStr)
 	return
 }
-
-// exitIfError 发生错误就停止运行
-func exitIfError(err error) {
-	if err != nil {
-		fmt.Printf("fatal error: %v\n", err)
-		os.Exit(1)
-	}
-}
@@ -1,11 +1,12 @@
 package dao
 
 import (
+	"database/sql"
 	"fmt"
 )
 
-func GetDocumentId(title string) (int, error) {
-	stmt, err := db.Prepare("SELECT id FROM documents WHERE title = ?;")
+func (s *MySQLStore) GetDocumentID(title string) (int, error) {
+	stmt, err := s.db.Prepare("SELECT id FROM documents WHERE title = ?;")
 	if err != nil {
 		fmt.Println("failed to get document id, prepare sql err: ", err.Error())
 		return 0, err
@@ -14,6 +15,9 @@ func GetDocumentId(title string) (int, error) {
 
 	var id int
 	err = stmt.QueryRow(title).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
 	if err != nil {
 		fmt.Println("failed to get document id, err: ", err.Error())
 		return 0, err
@@ -21,8 +25,8 @@ func GetDocumentId(title string) (int, error) {
 	return id, nil
 }
 
-func GetDocumentTitle(id int) (string, error) {
-	stmt, err := db.Prepare("SELECT title FROM documents WHERE id = ?;")
+func (s *MySQLStore) GetDocumentTitle(id int) (string, error) {
+	stmt, err := s.db.Prepare("SELECT title FROM documents WHERE id = ?;")
 	if err != nil {
 		fmt.Println("failed to get document title, prepare sql err: ", err.Error())
 		return "", err
@@ -38,44 +42,101 @@ func GetDocumentTitle(id int) (string, error) {
 	return title, nil
 }
 
-func InsertDocument(title, body string) bool {
-	stmt, err := db.Prepare("INSERT INTO documents (title, body) VALUES (?, ?);")
+func (s *MySQLStore) GetDocumentBody(id int) (string, error) {
+	stmt, err := s.db.Prepare("SELECT body FROM documents WHERE id = ?;")
+	if err != nil {
+		fmt.Println("failed to get document body, prepare sql err: ", err.Error())
+		return "", err
+	}
+	defer stmt.Close()
+
+	var body string
+	err = stmt.QueryRow(id).Scan(&body)
+	if err != nil {
+		fmt.Println("failed to get document body, err: ", err.Error())
+		return "", err
+	}
+	return body, nil
+}
+
+func (s *MySQLStore) InsertDocument(title, body string) error {
+	stmt, err := s.db.Prepare("INSERT INTO documents (title, body) VALUES (?, ?);")
 	if err != nil {
 		fmt.Println("failed to insert document, prepare sql err: ", err.Error())
-		return false
+		return err
 	}
 	defer stmt.Close()
 
 	ret, err := stmt.Exec(title, body)
 	if err != nil {
 		fmt.Println("failed to insert document, err: ", err.Error())
-		return false
+		return err
+	}
+	rowsAffected, err := ret.RowsAffected()
+	if err != nil {
+		fmt.Println("failed to insert document when rows affected, err: ", err.Error())
+		return err
 	}
-	if rowsAffected, err := ret.RowsAffected(); nil == err && rowsAffected > 0 {
-		return true
+	if rowsAffected == 0 {
+		return fmt.Errorf("failed to insert document %q: no rows affected", title)
 	}
-	fmt.Println("failed to insert document no rows affected, err: ", err)
-	return false
+	return nil
 }
 
-func UpdateDocument(id int, body string) bool {
-	stmt, err := db.Prepare("UPDATE documents set body = ? WHERE id = ?;")
+func (s *MySQLStore) UpdateDocument(id int, body string) error {
+	stmt, err := s.db.Prepare("UPDATE documents set body = ? WHERE id = ?;")
 	if err != nil {
 		fmt.Println("failed to update document, prepare sql err: ", err.Error())
-		return false
+		return err
 	}
 	defer stmt.Close()
 
 	_, err = stmt.Exec(body, id)
 	if err != nil {
 		fmt.Println("failed to update document, err: ", err.Error())
-		return false
+		return err
+	}
+	return nil
+}
+
+func (s *MySQLStore) GetDocumentLength(id int) (int, error) {
+	stmt, err := s.db.Prepare("SELECT token_count FROM documents WHERE id = ?;")
+	if err != nil {
+		fmt.Println("failed to get document length, prepare sql err: ", err.Error())
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var length int
+	err = stmt.QueryRow(id).Scan(&length)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		fmt.Println("failed to get document length, err: ", err.Error())
+		return 0, err
+	}
+	return length, nil
+}
+
+func (s *MySQLStore) UpdateDocumentLength(id, length int) error {
+	stmt, err := s.db.Prepare("UPDATE documents SET token_count = ? WHERE id = ?;")
+	if err != nil {
+		fmt.Println("failed to update document length, prepare sql err: ", err.Error())
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(length, id)
+	if err != nil {
+		fmt.Println("failed to update document length, err: ", err.Error())
+		return err
 	}
-	return true
+	return nil
 }
 
-func GetTokenId(token string) (int, int, error) {
-	stmt, err := db.Prepare("SELECT id, docs_count FROM tokens WHERE token = ?;")
+func (s *MySQLStore) GetTokenID(token string) (int, int, error) {
+	stmt, err := s.db.Prepare("SELECT id, docs_count FROM tokens WHERE token = ?;")
 	if err != nil {
 		fmt.Println("failed to get token id, prepare sql err: ", err.Error())
 		return 0, 0, err
@@ -84,16 +145,18 @@ func GetTokenId(token string) (int, int, error) {
 
 	var id, count int
 	err = stmt.QueryRow(token).Scan(&id, &count)
+	if err == sql.ErrNoRows {
+		return 0, 0, nil
+	}
 	if err != nil {
-		panic(err)
 		fmt.Println("failed to get token id, err: ", err.Error())
 		return 0, 0, err
 	}
 	return id, count, nil
 }
 
-func GetToken(id int) (string, error) {
-	stmt, err := db.Prepare("SELECT token FROM tokens WHERE id = ?;")
+func (s *MySQLStore) GetToken(id int) (string, error) {
+	stmt, err := s.db.Prepare("SELECT token FROM tokens WHERE id = ?;")
 	if err != nil {
 		fmt.Println("failed to get token, prepare sql err: ", err.Error())
 		return "", err
@@ -109,59 +172,124 @@ func GetToken(id int) (string, error) {
 	return token, nil
 }
 
-func StoreToken(token, postings string) bool {
-	stmt, err := db.Prepare("INSERT IGNORE INTO tokens (token, docs_count, postings) VALUES (?, 1, ?);")
+func (s *MySQLStore) StoreToken(token string, postings []byte) error {
+	stmt, err := s.db.Prepare("INSERT IGNORE INTO tokens (token, docs_count, postings) VALUES (?, 1, ?);")
 	if err != nil {
 		fmt.Println("failed to store token, prepare sql err: ", err.Error())
-		return false
+		return err
 	}
 	defer stmt.Close()
 
+	if postings == nil {
+		postings = []byte{}
+	}
 	_, err = stmt.Exec(token, postings)
 	if err != nil {
 		fmt.Println("failed to store token, err: ", err.Error())
-		return false
+		return err
+	}
+	return nil
+}
+
+func (s *MySQLStore) GetTokenIDs() ([]int, error) {
+	rows, err := s.db.Query("SELECT id FROM tokens ORDER BY id;")
+	if err != nil {
+		fmt.Println("failed to get token ids, err: ", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			fmt.Println("failed to get token ids, scan err: ", err.Error())
+			return nil, err
+		}
+		ids = append(ids, id)
 	}
-	return true
+	return ids, rows.Err()
 }
 
-func GetPostings(id int) (int, string, error) {
-	stmt, err := db.Prepare("SELECT docs_count, postings FROM tokens WHERE id = ?;")
+func (s *MySQLStore) GetPostings(id int) (int, []byte, error) {
+	stmt, err := s.db.Prepare("SELECT docs_count, postings FROM tokens WHERE id = ?;")
 	if err != nil {
 		fmt.Println("failed to get postings, prepare sql err: ", err.Error())
-		return 0, "", err
+		return 0, nil, err
 	}
 	defer stmt.Close()
 
 	var count int
-	var postings string
+	var postings []byte
 	err = stmt.QueryRow(id).Scan(&count, &postings)
+	if err == sql.ErrNoRows {
+		return 0, nil, nil
+	}
 	if err != nil {
-		fmt.Println("failed to get document count, err: ", err.Error())
-		return 0, "", err
+		fmt.Println("failed to get postings, err: ", err.Error())
+		return 0, nil, err
+	}
+	if len(postings) == 0 {
+		return count, nil, nil
 	}
 	return count, postings, nil
 }
 
-func UpdatePostings(id, count int, postings string) bool {
-	fmt.Printf("更新倒排列表 id: %d, count: %d, postings:%s", id, count, postings)
-	stmt, err := db.Prepare("UPDATE tokens SET docs_count = ?, postings = ? WHERE id = ?;")
+func (s *MySQLStore) UpdateDocsCount(id, count int) error {
+	stmt, err := s.db.Prepare("UPDATE tokens SET docs_count = ? WHERE id = ?;")
+	if err != nil {
+		fmt.Println("failed to update docs count, prepare sql err: ", err.Error())
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(count, id)
+	if err != nil {
+		fmt.Println("failed to update docs count, err: ", err.Error())
+		return err
+	}
+	return nil
+}
+
+func (s *MySQLStore) UpdatePostings(id, count, maxTermFrequency int, postings []byte) error {
+	stmt, err := s.db.Prepare("UPDATE tokens SET docs_count = ?, max_tf = ?, postings = ? WHERE id = ?;")
 	if err != nil {
 		fmt.Println("failed to update postings, prepare sql err: ", err.Error())
-		return false
+		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(count, postings, id)
+	_, err = stmt.Exec(count, maxTermFrequency, postings, id)
 	if err != nil {
 		fmt.Println("failed to update postings, err: ", err.Error())
-		return false
+		return err
+	}
+	return nil
+}
+
+func (s *MySQLStore) GetTokenMaxTermFrequency(id int) (int, error) {
+	stmt, err := s.db.Prepare("SELECT max_tf FROM tokens WHERE id = ?;")
+	if err != nil {
+		fmt.Println("failed to get max tf, prepare sql err: ", err.Error())
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var maxTermFrequency int
+	err = stmt.QueryRow(id).Scan(&maxTermFrequency)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		fmt.Println("failed to get max tf, err: ", err.Error())
+		return 0, err
 	}
-	return true
+	return maxTermFrequency, nil
 }
 
-func GetSettings(key string) (string, error) {
-	stmt, err := db.Prepare("SELECT value FROM settings WHERE key = ?;")
+func (s *MySQLStore) GetSettings(key string) (string, error) {
+	stmt, err := s.db.Prepare("SELECT `value` FROM settings WHERE `key` = ? ORDER BY id DESC LIMIT 1;")
 	if err != nil {
 		fmt.Println("failed to get settings, prepare sql err: ", err.Error())
 		return "", err
@@ -170,6 +298,9 @@ func GetSettings(key string) (string, error) {
 
 	var value string
 	err = stmt.QueryRow(key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
 	if err != nil {
 		fmt.Println("failed to get settings, err: ", err.Error())
 		return "", err
@@ -177,24 +308,30 @@ func GetSettings(key string) (string, error) {
 	return value, nil
 }
 
-func ReplaceSettings(key, value string) bool {
-	stmt, err := db.Prepare("INSERT OR REPLACE INTO settings (key, value) VALUES (?, ?);")
+func (s *MySQLStore) ReplaceSettings(key, value string) error {
+	// settings 表的 key 列上没有唯一索引，所以先删除旧值再插入新值
+	tx, err := s.db.Begin()
 	if err != nil {
-		fmt.Println("failed to replace settings, prepare sql err: ", err.Error())
-		return false
+		fmt.Println("failed to replace settings, begin err: ", err.Error())
+		return err
 	}
-	defer stmt.Close()
-
-	_, err = stmt.Exec(key, value)
+	_, err = tx.Exec("DELETE FROM settings WHERE `key` = ?;", key)
+	if err != nil {
+		tx.Rollback()
+		fmt.Println("failed to replace settings, delete err: ", err.Error())
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO settings (`key`, `value`) VALUES (?, ?);", key, value)
 	if err != nil {
+		tx.Rollback()
 		fmt.Println("failed to replace settings, err: ", err.Error())
-		return false
+		return err
 	}
-	return true
+	return tx.Commit()
 }
 
-func GetDocumentCount() (int, error) {
-	stmt, err := db.Prepare("SELECT COUNT(*) FROM documents;")
+func (s *MySQLStore) GetDocumentCount() (int, error) {
+	stmt, err := s.db.Prepare("SELECT COUNT(*) FROM documents WHERE deleted = 0;")
 	if err != nil {
 		fmt.Println("failed to get document count, prepare sql err: ", err.Error())
 		return 0, err
@@ -209,3 +346,148 @@ func GetDocumentCount() (int, error) {
 	}
 	return count, nil
 }
+
+func (s *MySQLStore) DeleteDocument(id int) error {
+	stmt, err := s.db.Prepare("UPDATE documents SET deleted = 1 WHERE id = ?;")
+	if err != nil {
+		fmt.Println("failed to delete document, prepare sql err: ", err.Error())
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(id)
+	if err != nil {
+		fmt.Println("failed to delete document, err: ", err.Error())
+		return err
+	}
+	return nil
+}
+
+func (s *MySQLStore) IsDocumentDeleted(id int) (bool, error) {
+	stmt, err := s.db.Prepare("SELECT deleted FROM documents WHERE id = ?;")
+	if err != nil {
+		fmt.Println("failed to get document deleted, prepare sql err: ", err.Error())
+		return false, err
+	}
+	defer stmt.Close()
+
+	var deleted bool
+	err = stmt.QueryRow(id).Scan(&deleted)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		fmt.Println("failed to get document deleted, err: ", err.Error())
+		return false, err
+	}
+	return deleted, nil
+}
+
+func (s *MySQLStore) GetDeletedDocumentIDs() ([]int, error) {
+	rows, err := s.db.Query("SELECT id FROM documents WHERE deleted = 1 ORDER BY id;")
+	if err != nil {
+		fmt.Println("failed to get deleted document ids, err: ", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			fmt.Println("failed to get deleted document ids, scan err: ", err.Error())
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *MySQLStore) PurgeDocument(id int) error {
+	stmt, err := s.db.Prepare("DELETE FROM documents WHERE id = ? AND deleted = 1;")
+	if err != nil {
+		fmt.Println("failed to purge document, prepare sql err: ", err.Error())
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(id)
+	if err != nil {
+		fmt.Println("failed to purge document, err: ", err.Error())
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return nil
+	}
+	_, err = s.db.Exec("DELETE FROM document_metadata WHERE document_id = ?;", id)
+	if err != nil {
+		fmt.Println("failed to purge document metadata, err: ", err.Error())
+		return err
+	}
+	return nil
+}
+
+func (s *MySQLStore) GetDocumentMetadata(id int) (map[string]string, error) {
+	rows, err := s.db.Query("SELECT `key`, `value` FROM document_metadata WHERE document_id = ?;", id)
+	if err != nil {
+		fmt.Println("failed to get document metadata, err: ", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	metadata := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		err = rows.Scan(&key, &value)
+		if err != nil {
+			fmt.Println("failed to get document metadata, scan err: ", err.Error())
+			return nil, err
+		}
+		metadata[key] = value
+	}
+	return metadata, rows.Err()
+}
+
+func (s *MySQLStore) UpdateDocumentMetadata(id int, key, value string) error {
+	var err error
+	if value == "" {
+		_, err = s.db.Exec("DELETE FROM document_metadata WHERE document_id = ? AND `key` = ?;", id, key)
+	} else {
+		_, err = s.db.Exec("INSERT INTO document_metadata (document_id, `key`, `value`) VALUES (?, ?, ?) "+
+			"ON DUPLICATE KEY UPDATE `value` = VALUES(`value`);", id, key, value)
+	}
+	if err != nil {
+		fmt.Println("failed to update document metadata, err: ", err.Error())
+		return err
+	}
+	return nil
+}
+
+func (s *MySQLStore) GetAliasTarget(alias string) (string, error) {
+	var target string
+	err := s.db.QueryRow("SELECT target FROM aliases WHERE alias = ?;", alias).Scan(&target)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		fmt.Println("failed to get alias target, err: ", err.Error())
+		return "", err
+	}
+	return target, nil
+}
+
+func (s *MySQLStore) ReplaceAlias(alias, target string) error {
+	var err error
+	if target == "" {
+		_, err = s.db.Exec("DELETE FROM aliases WHERE alias = ?;", alias)
+	} else {
+		_, err = s.db.Exec("INSERT INTO aliases (alias, target) VALUES (?, ?) "+
+			"ON DUPLICATE KEY UPDATE target = VALUES(target);", alias, target)
+	}
+	if err != nil {
+		fmt.Println("failed to replace alias, err: ", err.Error())
+		return err
+	}
+	return nil
+}
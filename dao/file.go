@@ -0,0 +1,861 @@
+package dao
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// 文件头，用于识别存储文件及其格式版本
+var fileStoreMagic = []byte("WISERDB1")
+
+// 记录的种类
+const (
+	opInsertDocument byte = iota + 1
+	opUpdateDocument
+	opStoreToken
+	opUpdatePostings
+	opReplaceSettings
+	opUpdateDocumentLength
+	opDeleteDocument
+	opPurgeDocument
+	opUpdateDocsCount
+	opUpdateDocumentMetadata
+	opReplaceAlias
+	opLastIDs
+)
+
+// 压缩后的文件中每条记录的长度和校验和等开销的上限，用于估计压缩后的文件大小
+const fileRecordOverhead = 2*binary.MaxVarintLen64 + 4
+
+var _ Store = (*FileStore)(nil)
+
+// 使用本地单个文件作为存储后端，不需要外部的数据库服务
+// 所有的修改都以记录的形式追加到文件末尾，打开文件时通过回放记录重建内存中的索引。
+// 内存中只保存标题、词元、文档数等元数据，文档正文和倒排列表只记录其在文件中的位置，
+// 需要时再从文件中读取。
+// 被覆盖的记录依然留在文件中，Compact 只保留有效的数据重写文件。
+type FileStore struct {
+	mu   sync.RWMutex
+	path string
+	f    *os.File
+	size int64 // 文件中有效数据的末尾位置
+
+	documents map[int]*fileDocument // 以文档编号为键
+	titles    map[string]int        // 以文档标题为键，值为文档编号
+	tokens    map[int]*fileToken    // 以词元编号为键
+	tokenIDs  map[string]int        // 以词元为键，值为词元编号
+	settings  map[string]string
+	aliases   map[string]string // 以别名为键，值为文档标题
+
+	lastDocumentID int // 最后分配的文档编号
+	lastTokenID    int // 最后分配的词元编号
+	deletedCount   int // 已标记为删除但尚未清除的文档数
+}
+
+// 文件中的一段数据
+type fileValue struct {
+	offset int64
+	length int
+}
+
+type fileDocument struct {
+	title    string
+	body     fileValue
+	length   int
+	deleted  bool
+	metadata map[string]fileValue // 元数据的值也只记录其在文件中的位置
+}
+
+type fileToken struct {
+	token            string
+	docsCount        int
+	maxTermFrequency int
+	postings         fileValue
+}
+
+// 打开（不存在时创建）存储文件
+// path 存储文件的路径
+func NewFileStore(path string) (*FileStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileStore{path: path, f: f}
+	err = s.load()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// 清空内存中的索引
+func (s *FileStore) reset() {
+	s.documents = make(map[int]*fileDocument)
+	s.titles = make(map[string]int)
+	s.tokens = make(map[int]*fileToken)
+	s.tokenIDs = make(map[string]int)
+	s.settings = make(map[string]string)
+	s.aliases = make(map[string]string)
+	s.lastDocumentID = 0
+	s.lastTokenID = 0
+	s.deletedCount = 0
+}
+
+// 读取文件头并回放所有记录
+// 文件末尾不完整或校验失败的记录（例如写入时进程被中止）会被截断
+func (s *FileStore) load() error {
+	s.reset()
+	info, err := s.f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		_, err = s.f.WriteAt(fileStoreMagic, 0)
+		if err != nil {
+			return err
+		}
+		s.size = int64(len(fileStoreMagic))
+		return nil
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(s.f, 0, info.Size()))
+	magic := make([]byte, len(fileStoreMagic))
+	_, err = io.ReadFull(r, magic)
+	if err != nil || !bytes.Equal(magic, fileStoreMagic) {
+		return errors.New("not a wiser store file")
+	}
+	offset := int64(len(magic))
+	for {
+		payload, n, err := readRecord(r, info.Size()-offset)
+		if err != nil {
+			break
+		}
+		// 记录头之后才是记录的内容
+		err = s.apply(payload, offset+int64(n-len(payload)))
+		if err != nil {
+			return err
+		}
+		offset += int64(n)
+	}
+	s.size = offset
+	if offset < info.Size() {
+		return s.f.Truncate(offset)
+	}
+	return nil
+}
+
+// 读取一条记录
+// 记录的格式为：内容长度（uvarint）、内容的 CRC32（4 字节）、内容
+// remaining 文件中剩余的字节数，长度为 0 或超出剩余字节数的记录视为损坏
+// 返回记录的内容和整条记录占用的字节数
+func readRecord(r *bufio.Reader, remaining int64) ([]byte, int, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	var header [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(header[:], length)
+	if length == 0 || length > uint64(remaining) || int64(length) > remaining-int64(n)-4 {
+		return nil, 0, errors.New("invalid record length")
+	}
+
+	var sum [4]byte
+	_, err = io.ReadFull(r, sum[:])
+	if err != nil {
+		return nil, 0, err
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(sum[:]) {
+		return nil, 0, errors.New("checksum mismatch")
+	}
+	return payload, n + len(sum) + len(payload), nil
+}
+
+// 将一条记录的修改应用到内存中的索引上
+// payload 记录的内容
+// offset 记录内容在文件中的起始位置
+func (s *FileStore) apply(payload []byte, offset int64) error {
+	d := &recordDecoder{buf: payload[1:], base: offset + 1}
+	switch payload[0] {
+	case opInsertDocument:
+		id := d.int()
+		title := string(d.bytes())
+		body := d.value()
+		s.documents[id] = &fileDocument{title: title, body: body}
+		s.titles[title] = id
+		if id > s.lastDocumentID {
+			s.lastDocumentID = id
+		}
+	case opUpdateDocument:
+		id := d.int()
+		body := d.value()
+		if doc, ok := s.documents[id]; ok {
+			doc.body = body
+		}
+	case opStoreToken:
+		id := d.int()
+		token := string(d.bytes())
+		count := d.int()
+		postings := d.value()
+		s.tokens[id] = &fileToken{token: token, docsCount: count, postings: postings}
+		s.tokenIDs[token] = id
+		if id > s.lastTokenID {
+			s.lastTokenID = id
+		}
+	case opUpdatePostings:
+		id := d.int()
+		count := d.int()
+		maxTermFrequency := d.int()
+		postings := d.value()
+		if t, ok := s.tokens[id]; ok {
+			t.docsCount = count
+			t.maxTermFrequency = maxTermFrequency
+			t.postings = postings
+		}
+	case opUpdateDocumentLength:
+		id := d.int()
+		length := d.int()
+		if doc, ok := s.documents[id]; ok {
+			doc.length = length
+		}
+	case opDeleteDocument:
+		id := d.int()
+		if doc, ok := s.documents[id]; ok && !doc.deleted {
+			doc.deleted = true
+			s.deletedCount++
+		}
+	case opPurgeDocument:
+		id := d.int()
+		if doc, ok := s.documents[id]; ok && doc.deleted {
+			delete(s.titles, doc.title)
+			delete(s.documents, id)
+			s.deletedCount--
+		}
+	case opUpdateDocsCount:
+		id := d.int()
+		count := d.int()
+		if t, ok := s.tokens[id]; ok {
+			t.docsCount = count
+		}
+	case opUpdateDocumentMetadata:
+		id := d.int()
+		key := string(d.bytes())
+		value := d.value()
+		if doc, ok := s.documents[id]; ok {
+			if value.length == 0 {
+				delete(doc.metadata, key)
+			} else {
+				if doc.metadata == nil {
+					doc.metadata = make(map[string]fileValue)
+				}
+				doc.metadata[key] = value
+			}
+		}
+	case opReplaceAlias:
+		alias := string(d.bytes())
+		target := string(d.bytes())
+		if target == "" {
+			delete(s.aliases, alias)
+		} else {
+			s.aliases[alias] = target
+		}
+	case opReplaceSettings:
+		key := string(d.bytes())
+		value := string(d.bytes())
+		s.settings[key] = value
+	case opLastIDs:
+		// 压缩时记录，已清除的文档的编号不会再次分配
+		documentID := d.int()
+		tokenID := d.int()
+		if documentID > s.lastDocumentID {
+			s.lastDocumentID = documentID
+		}
+		if tokenID > s.lastTokenID {
+			s.lastTokenID = tokenID
+		}
+	default:
+		return fmt.Errorf("unknown record type %d", payload[0])
+	}
+	return d.err
+}
+
+// 在记录内容之前加上长度和校验和，返回整条记录
+func encodeRecord(payload []byte) []byte {
+	var header [binary.MaxVarintLen64 + 4]byte
+	n := binary.PutUvarint(header[:], uint64(len(payload)))
+	binary.BigEndian.PutUint32(header[n:], crc32.ChecksumIEEE(payload))
+	n += 4
+
+	record := make([]byte, 0, n+len(payload))
+	record = append(record, header[:n]...)
+	return append(record, payload...)
+}
+
+// 将记录追加到文件末尾，并将其应用到内存中的索引上
+func (s *FileStore) append(e *recordEncoder) error {
+	payload := e.buf.Bytes()
+	record := encodeRecord(payload)
+	_, err := s.f.WriteAt(record, s.size)
+	if err != nil {
+		return err
+	}
+	offset := s.size + int64(len(record)-len(payload))
+	s.size += int64(len(record))
+	return s.apply(payload, offset)
+}
+
+// 从文件中读取一段数据
+func (s *FileStore) read(v fileValue) ([]byte, error) {
+	if v.length == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, v.length)
+	_, err := s.f.ReadAt(buf, v.offset)
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// 关闭存储文件，文件中一半以上是无效的数据时先进行压缩
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	if s.size > 2*s.liveSize() {
+		err = s.compact()
+	}
+	if serr := s.f.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// 只将有效的数据写入临时文件，再用临时文件替换存储文件
+// 被覆盖的正文、倒排列表、设置项以及已清除的文档不再占用空间
+func (s *FileStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compact()
+}
+
+func (s *FileStore) compact() error {
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	err = s.writeLive(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	// 替换之前打开的文件依然可以读取，重新打开失败时继续使用
+	f, err := os.OpenFile(s.path, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	s.f.Close()
+	s.f = f
+	return s.load()
+}
+
+// 将内存中的索引作为记录写入 w，不包括已被覆盖的数据
+func (s *FileStore) writeLive(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	write := func(e *recordEncoder) {
+		bw.Write(encodeRecord(e.buf.Bytes()))
+	}
+	bw.Write(fileStoreMagic)
+
+	e := newRecordEncoder(opLastIDs)
+	e.int(s.lastDocumentID)
+	e.int(s.lastTokenID)
+	write(e)
+	for _, key := range sortedKeys(s.settings) {
+		e = newRecordEncoder(opReplaceSettings)
+		e.bytes([]byte(key))
+		e.bytes([]byte(s.settings[key]))
+		write(e)
+	}
+	for _, alias := range sortedKeys(s.aliases) {
+		e = newRecordEncoder(opReplaceAlias)
+		e.bytes([]byte(alias))
+		e.bytes([]byte(s.aliases[alias]))
+		write(e)
+	}
+
+	ids := make([]int, 0, len(s.documents))
+	for id := range s.documents {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		doc := s.documents[id]
+		body, err := s.read(doc.body)
+		if err != nil {
+			return err
+		}
+		e = newRecordEncoder(opInsertDocument)
+		e.int(id)
+		e.bytes([]byte(doc.title))
+		e.bytes(body)
+		write(e)
+		if doc.length != 0 {
+			e = newRecordEncoder(opUpdateDocumentLength)
+			e.int(id)
+			e.int(doc.length)
+			write(e)
+		}
+		for key, v := range doc.metadata {
+			value, err := s.read(v)
+			if err != nil {
+				return err
+			}
+			e = newRecordEncoder(opUpdateDocumentMetadata)
+			e.int(id)
+			e.bytes([]byte(key))
+			e.bytes(value)
+			write(e)
+		}
+		if doc.deleted {
+			e = newRecordEncoder(opDeleteDocument)
+			e.int(id)
+			write(e)
+		}
+	}
+
+	ids = ids[:0]
+	for id := range s.tokens {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		t := s.tokens[id]
+		postings, err := s.read(t.postings)
+		if err != nil {
+			return err
+		}
+		e = newRecordEncoder(opStoreToken)
+		e.int(id)
+		e.bytes([]byte(t.token))
+		e.int(t.docsCount)
+		e.bytes(nil)
+		write(e)
+		e = newRecordEncoder(opUpdatePostings)
+		e.int(id)
+		e.int(t.docsCount)
+		e.int(t.maxTermFrequency)
+		e.bytes(postings)
+		write(e)
+	}
+	return bw.Flush()
+}
+
+// 估计压缩后的文件大小，作为上限，每条记录按 fileRecordOverhead 计算开销
+func (s *FileStore) liveSize() int64 {
+	n := int64(len(fileStoreMagic) + fileRecordOverhead)
+	for k, v := range s.settings {
+		n += int64(len(k) + len(v) + fileRecordOverhead)
+	}
+	for k, v := range s.aliases {
+		n += int64(len(k) + len(v) + fileRecordOverhead)
+	}
+	for _, doc := range s.documents {
+		n += int64(len(doc.title) + doc.body.length + 3*fileRecordOverhead)
+		for k, v := range doc.metadata {
+			n += int64(len(k) + v.length + fileRecordOverhead)
+		}
+	}
+	for _, t := range s.tokens {
+		n += int64(len(t.token) + t.postings.length + 2*fileRecordOverhead)
+	}
+	return n
+}
+
+// 返回按升序排列的键
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *FileStore) GetDocumentID(title string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.titles[title], nil
+}
+
+func (s *FileStore) GetDocumentTitle(id int) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	doc, ok := s.documents[id]
+	if !ok {
+		return "", fmt.Errorf("document %d not found", id)
+	}
+	return doc.title, nil
+}
+
+func (s *FileStore) GetDocumentBody(id int) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	doc, ok := s.documents[id]
+	if !ok {
+		return "", fmt.Errorf("document %d not found", id)
+	}
+	body, err := s.read(doc.body)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+func (s *FileStore) InsertDocument(title, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.titles[title]; ok {
+		return fmt.Errorf("document %q already exists", title)
+	}
+	e := newRecordEncoder(opInsertDocument)
+	e.int(s.lastDocumentID + 1)
+	e.bytes([]byte(title))
+	e.bytes([]byte(body))
+	return s.append(e)
+}
+
+func (s *FileStore) UpdateDocument(id int, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.documents[id]; !ok {
+		return nil
+	}
+	e := newRecordEncoder(opUpdateDocument)
+	e.int(id)
+	e.bytes([]byte(body))
+	return s.append(e)
+}
+
+func (s *FileStore) GetDocumentCount() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.documents) - s.deletedCount, nil
+}
+
+func (s *FileStore) DeleteDocument(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if doc, ok := s.documents[id]; !ok || doc.deleted {
+		return nil
+	}
+	e := newRecordEncoder(opDeleteDocument)
+	e.int(id)
+	return s.append(e)
+}
+
+func (s *FileStore) IsDocumentDeleted(id int) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	doc, ok := s.documents[id]
+	return ok && doc.deleted, nil
+}
+
+func (s *FileStore) GetDeletedDocumentIDs() ([]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var ids []int
+	for id, doc := range s.documents {
+		if doc.deleted {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (s *FileStore) PurgeDocument(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if doc, ok := s.documents[id]; !ok || !doc.deleted {
+		return nil
+	}
+	e := newRecordEncoder(opPurgeDocument)
+	e.int(id)
+	return s.append(e)
+}
+
+func (s *FileStore) GetDocumentLength(id int) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if doc, ok := s.documents[id]; ok {
+		return doc.length, nil
+	}
+	return 0, nil
+}
+
+func (s *FileStore) UpdateDocumentLength(id, length int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.documents[id]; !ok {
+		return nil
+	}
+	e := newRecordEncoder(opUpdateDocumentLength)
+	e.int(id)
+	e.int(length)
+	return s.append(e)
+}
+
+func (s *FileStore) GetDocumentMetadata(id int) (map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	metadata := make(map[string]string)
+	doc, ok := s.documents[id]
+	if !ok {
+		return metadata, nil
+	}
+	for k, v := range doc.metadata {
+		value, err := s.read(v)
+		if err != nil {
+			return nil, err
+		}
+		metadata[k] = string(value)
+	}
+	return metadata, nil
+}
+
+func (s *FileStore) UpdateDocumentMetadata(id int, key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.documents[id]; !ok {
+		return nil
+	}
+	e := newRecordEncoder(opUpdateDocumentMetadata)
+	e.int(id)
+	e.bytes([]byte(key))
+	e.bytes([]byte(value))
+	return s.append(e)
+}
+
+func (s *FileStore) GetAliasTarget(alias string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.aliases[alias], nil
+}
+
+func (s *FileStore) ReplaceAlias(alias, target string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.aliases[alias] == target {
+		return nil
+	}
+	e := newRecordEncoder(opReplaceAlias)
+	e.bytes([]byte(alias))
+	e.bytes([]byte(target))
+	return s.append(e)
+}
+
+func (s *FileStore) GetTokenID(token string) (int, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	id, ok := s.tokenIDs[token]
+	if !ok {
+		return 0, 0, nil
+	}
+	return id, s.tokens[id].docsCount, nil
+}
+
+func (s *FileStore) GetToken(id int) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tokens[id]
+	if !ok {
+		return "", fmt.Errorf("token %d not found", id)
+	}
+	return t.token, nil
+}
+
+func (s *FileStore) StoreToken(token string, postings []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tokenIDs[token]; ok {
+		return nil
+	}
+	e := newRecordEncoder(opStoreToken)
+	e.int(s.lastTokenID + 1)
+	e.bytes([]byte(token))
+	e.int(1)
+	e.bytes(postings)
+	return s.append(e)
+}
+
+func (s *FileStore) GetTokenIDs() ([]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]int, 0, len(s.tokens))
+	for id := range s.tokens {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (s *FileStore) GetPostings(id int) (int, []byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tokens[id]
+	if !ok {
+		return 0, nil, nil
+	}
+	postings, err := s.read(t.postings)
+	if err != nil {
+		return 0, nil, err
+	}
+	return t.docsCount, postings, nil
+}
+
+func (s *FileStore) UpdateDocsCount(id, count int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tokens[id]; !ok {
+		return nil
+	}
+	e := newRecordEncoder(opUpdateDocsCount)
+	e.int(id)
+	e.int(count)
+	return s.append(e)
+}
+
+func (s *FileStore) UpdatePostings(id, count, maxTermFrequency int, postings []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tokens[id]; !ok {
+		return nil
+	}
+	e := newRecordEncoder(opUpdatePostings)
+	e.int(id)
+	e.int(count)
+	e.int(maxTermFrequency)
+	e.bytes(postings)
+	return s.append(e)
+}
+
+func (s *FileStore) GetTokenMaxTermFrequency(id int) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if t, ok := s.tokens[id]; ok {
+		return t.maxTermFrequency, nil
+	}
+	return 0, nil
+}
+
+func (s *FileStore) GetSettings(key string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.settings[key], nil
+}
+
+func (s *FileStore) ReplaceSettings(key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := newRecordEncoder(opReplaceSettings)
+	e.bytes([]byte(key))
+	e.bytes([]byte(value))
+	return s.append(e)
+}
+
+// 用于构造记录内容
+type recordEncoder struct {
+	buf bytes.Buffer
+	tmp [binary.MaxVarintLen64]byte
+}
+
+func newRecordEncoder(op byte) *recordEncoder {
+	e := &recordEncoder{}
+	e.buf.WriteByte(op)
+	return e
+}
+
+func (e *recordEncoder) int(v int) {
+	n := binary.PutVarint(e.tmp[:], int64(v))
+	e.buf.Write(e.tmp[:n])
+}
+
+func (e *recordEncoder) bytes(b []byte) {
+	n := binary.PutUvarint(e.tmp[:], uint64(len(b)))
+	e.buf.Write(e.tmp[:n])
+	e.buf.Write(b)
+}
+
+// 用于解析记录内容，遇到错误后的读取都返回零值
+type recordDecoder struct {
+	buf  []byte
+	pos  int
+	base int64 // buf 在文件中的起始位置
+	err  error
+}
+
+func (d *recordDecoder) int() int {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf[d.pos:])
+	if n <= 0 {
+		d.err = errors.New("malformed record")
+		return 0
+	}
+	d.pos += n
+	return int(v)
+}
+
+// 读取一段数据，并返回其在文件中的位置
+func (d *recordDecoder) value() fileValue {
+	if d.err != nil {
+		return fileValue{}
+	}
+	length, n := binary.Uvarint(d.buf[d.pos:])
+	if n <= 0 || uint64(len(d.buf)-d.pos-n) < length {
+		d.err = errors.New("malformed record")
+		return fileValue{}
+	}
+	d.pos += n
+	v := fileValue{offset: d.base + int64(d.pos), length: int(length)}
+	d.pos += int(length)
+	return v
+}
+
+func (d *recordDecoder) bytes() []byte {
+	v := d.value()
+	if d.err != nil {
+		return nil
+	}
+	start := int(v.offset - d.base)
+	return d.buf[start : start+v.length]
+}
@@ -0,0 +1,322 @@
+package dao
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var _ Store = (*MemoryStore)(nil)
+
+// 将所有数据保存在内存中的存储后端
+// 进程退出后数据即丢失，适用于单元测试和临时建立的索引
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	documents map[int]*memoryDocument // 以文档编号为键
+	titles    map[string]int          // 以文档标题为键，值为文档编号
+	tokens    map[int]*memoryToken    // 以词元编号为键
+	tokenIDs  map[string]int          // 以词元为键，值为词元编号
+	settings  map[string]string
+	aliases   map[string]string // 以别名为键，值为文档标题
+
+	lastDocumentID int // 最后分配的文档编号
+	lastTokenID    int // 最后分配的词元编号
+	deletedCount   int // 已标记为删除但尚未清除的文档数
+}
+
+type memoryDocument struct {
+	title    string
+	body     string
+	length   int
+	deleted  bool
+	metadata map[string]string
+}
+
+type memoryToken struct {
+	token            string
+	docsCount        int
+	maxTermFrequency int
+	postings         []byte
+}
+
+// 新建一个空的内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		documents: make(map[int]*memoryDocument),
+		titles:    make(map[string]int),
+		tokens:    make(map[int]*memoryToken),
+		tokenIDs:  make(map[string]int),
+		settings:  make(map[string]string),
+		aliases:   make(map[string]string),
+	}
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func (s *MemoryStore) GetDocumentID(title string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.titles[title], nil
+}
+
+func (s *MemoryStore) GetDocumentTitle(id int) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	doc, ok := s.documents[id]
+	if !ok {
+		return "", fmt.Errorf("document %d not found", id)
+	}
+	return doc.title, nil
+}
+
+func (s *MemoryStore) GetDocumentBody(id int) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	doc, ok := s.documents[id]
+	if !ok {
+		return "", fmt.Errorf("document %d not found", id)
+	}
+	return doc.body, nil
+}
+
+func (s *MemoryStore) InsertDocument(title, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.titles[title]; ok {
+		return fmt.Errorf("document %q already exists", title)
+	}
+	s.lastDocumentID++
+	s.documents[s.lastDocumentID] = &memoryDocument{title: title, body: body}
+	s.titles[title] = s.lastDocumentID
+	return nil
+}
+
+func (s *MemoryStore) UpdateDocument(id int, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if doc, ok := s.documents[id]; ok {
+		doc.body = body
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetDocumentCount() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.documents) - s.deletedCount, nil
+}
+
+func (s *MemoryStore) DeleteDocument(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if doc, ok := s.documents[id]; ok && !doc.deleted {
+		doc.deleted = true
+		s.deletedCount++
+	}
+	return nil
+}
+
+func (s *MemoryStore) IsDocumentDeleted(id int) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	doc, ok := s.documents[id]
+	return ok && doc.deleted, nil
+}
+
+func (s *MemoryStore) GetDeletedDocumentIDs() ([]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var ids []int
+	for id, doc := range s.documents {
+		if doc.deleted {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (s *MemoryStore) PurgeDocument(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if doc, ok := s.documents[id]; ok && doc.deleted {
+		delete(s.titles, doc.title)
+		delete(s.documents, id)
+		s.deletedCount--
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetDocumentLength(id int) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if doc, ok := s.documents[id]; ok {
+		return doc.length, nil
+	}
+	return 0, nil
+}
+
+func (s *MemoryStore) UpdateDocumentLength(id, length int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if doc, ok := s.documents[id]; ok {
+		doc.length = length
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetTokenID(token string) (int, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	id, ok := s.tokenIDs[token]
+	if !ok {
+		return 0, 0, nil
+	}
+	return id, s.tokens[id].docsCount, nil
+}
+
+func (s *MemoryStore) GetToken(id int) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tokens[id]
+	if !ok {
+		return "", fmt.Errorf("token %d not found", id)
+	}
+	return t.token, nil
+}
+
+func (s *MemoryStore) StoreToken(token string, postings []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tokenIDs[token]; ok {
+		return nil
+	}
+	s.lastTokenID++
+	s.tokens[s.lastTokenID] = &memoryToken{token: token, docsCount: 1, postings: copyBytes(postings)}
+	s.tokenIDs[token] = s.lastTokenID
+	return nil
+}
+
+func (s *MemoryStore) GetTokenIDs() ([]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]int, 0, len(s.tokens))
+	for id := range s.tokens {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (s *MemoryStore) GetPostings(id int) (int, []byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tokens[id]
+	if !ok {
+		return 0, nil, nil
+	}
+	return t.docsCount, copyBytes(t.postings), nil
+}
+
+func (s *MemoryStore) UpdateDocsCount(id, count int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.tokens[id]; ok {
+		t.docsCount = count
+	}
+	return nil
+}
+
+func (s *MemoryStore) UpdatePostings(id, count, maxTermFrequency int, postings []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.tokens[id]; ok {
+		t.docsCount = count
+		t.maxTermFrequency = maxTermFrequency
+		t.postings = copyBytes(postings)
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetTokenMaxTermFrequency(id int) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if t, ok := s.tokens[id]; ok {
+		return t.maxTermFrequency, nil
+	}
+	return 0, nil
+}
+
+func (s *MemoryStore) GetSettings(key string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.settings[key], nil
+}
+
+func (s *MemoryStore) ReplaceSettings(key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings[key] = value
+	return nil
+}
+
+// 复制字节序列，避免调用方修改存储中的数据
+// 空的字节序列返回 nil
+func copyBytes(b []byte) []byte {
+	if len(b) == 0 {
+		return nil
+	}
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
+
+func (s *MemoryStore) GetDocumentMetadata(id int) (map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	metadata := make(map[string]string)
+	if doc, ok := s.documents[id]; ok {
+		for k, v := range doc.metadata {
+			metadata[k] = v
+		}
+	}
+	return metadata, nil
+}
+
+func (s *MemoryStore) UpdateDocumentMetadata(id int, key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc, ok := s.documents[id]
+	if !ok {
+		return nil
+	}
+	if value == "" {
+		delete(doc.metadata, key)
+		return nil
+	}
+	if doc.metadata == nil {
+		doc.metadata = make(map[string]string)
+	}
+	doc.metadata[key] = value
+	return nil
+}
+
+func (s *MemoryStore) GetAliasTarget(alias string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.aliases[alias], nil
+}
+
+func (s *MemoryStore) ReplaceAlias(alias, target string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if target == "" {
+		delete(s.aliases, alias)
+	} else {
+		s.aliases[alias] = target
+	}
+	return nil
+}
@@ -0,0 +1,512 @@
+package dao
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// 对存储后端的基本行为进行检查
+func testStore(t *testing.T, s Store) {
+	id, err := s.GetDocumentID("数学")
+	if err != nil || id != 0 {
+		t.Fatalf("GetDocumentID of missing document = %d, %v", id, err)
+	}
+	if err := DBAddDocument(s, "数学", "数学是研究数量的学科"); err != nil {
+		t.Fatal(err)
+	}
+	if err := DBAddDocument(s, "物理", "物理学"); err != nil {
+		t.Fatal(err)
+	}
+	if err := DBAddDocument(s, "数学", "数学"); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.GetDocumentCount(); n != 2 {
+		t.Errorf("GetDocumentCount = %d, want 2", n)
+	}
+	id, _ = s.GetDocumentID("物理")
+	if title, _ := s.GetDocumentTitle(id); title != "物理" {
+		t.Errorf("GetDocumentTitle(%d) = %q, want 物理", id, title)
+	}
+	if err := s.UpdateDocumentLength(id, 2); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.GetDocumentLength(id); n != 2 {
+		t.Errorf("GetDocumentLength(%d) = %d, want 2", id, n)
+	}
+
+	if err := s.StoreToken("数学", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StoreToken("数学", nil); err != nil {
+		t.Fatal(err)
+	}
+	tokenID, count, _ := s.GetTokenID("数学")
+	if tokenID == 0 || count != 1 {
+		t.Fatalf("GetTokenID = %d, %d", tokenID, count)
+	}
+	if token, _ := s.GetToken(tokenID); token != "数学" {
+		t.Errorf("GetToken(%d) = %q", tokenID, token)
+	}
+	if _, postings, _ := s.GetPostings(tokenID); postings != nil {
+		t.Errorf("postings of new token = %v, want nil", postings)
+	}
+	if n, _ := s.GetTokenMaxTermFrequency(tokenID); n != 0 {
+		t.Errorf("max tf of new token = %d, want 0", n)
+	}
+	if err := s.UpdatePostings(tokenID, 3, 7, []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	count, postings, _ := s.GetPostings(tokenID)
+	if count != 3 || !bytes.Equal(postings, []byte{1, 2, 3}) {
+		t.Errorf("GetPostings = %d, %v", count, postings)
+	}
+	if n, _ := s.GetTokenMaxTermFrequency(tokenID); n != 7 {
+		t.Errorf("GetTokenMaxTermFrequency = %d, want 7", n)
+	}
+	if err := s.UpdateDocsCount(tokenID, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, count, _ := s.GetTokenID("数学"); count != 2 {
+		t.Errorf("docs count after UpdateDocsCount = %d, want 2", count)
+	}
+	s.UpdateDocsCount(tokenID, 3)
+
+	if v, _ := s.GetSettings("compress"); v != "" {
+		t.Errorf("GetSettings of missing key = %q", v)
+	}
+	s.ReplaceSettings("compress", "none")
+	s.ReplaceSettings("compress", "golomb")
+	if v, _ := s.GetSettings("compress"); v != "golomb" {
+		t.Errorf("GetSettings = %q, want golomb", v)
+	}
+}
+
+// 检查删除文档的行为
+// 返回被删除的文档编号
+func testDeleteDocument(t *testing.T, s Store) int {
+	for _, title := range []string{"甲", "乙", "丙"} {
+		if err := DBAddDocument(s, title, title+"的正文"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	id, _ := s.GetDocumentID("乙")
+	if body, err := s.GetDocumentBody(id); err != nil || body != "乙的正文" {
+		t.Errorf("GetDocumentBody = %q, %v", body, err)
+	}
+	if err := s.DeleteDocument(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteDocument(id); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.GetDocumentCount(); n != 2 {
+		t.Errorf("GetDocumentCount after delete = %d, want 2", n)
+	}
+	if deleted, _ := s.IsDocumentDeleted(id); !deleted {
+		t.Errorf("IsDocumentDeleted(%d) = false", id)
+	}
+	if ids, _ := s.GetDeletedDocumentIDs(); len(ids) != 1 || ids[0] != id {
+		t.Errorf("GetDeletedDocumentIDs = %v, want [%d]", ids, id)
+	}
+	// 清除之前依然可以获取文档
+	if got, _ := s.GetDocumentID("乙"); got != id {
+		t.Errorf("GetDocumentID of deleted document = %d, want %d", got, id)
+	}
+	return id
+}
+
+// 检查清除已删除的文档的行为
+func testPurgeDocument(t *testing.T, s Store, id int) {
+	if ids, _ := s.GetDeletedDocumentIDs(); len(ids) != 1 || ids[0] != id {
+		t.Errorf("GetDeletedDocumentIDs = %v, want [%d]", ids, id)
+	}
+	// 未删除的文档不会被清除
+	live, _ := s.GetDocumentID("甲")
+	if err := s.PurgeDocument(live); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PurgeDocument(id); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.GetDocumentID("乙"); got != 0 {
+		t.Errorf("GetDocumentID of purged document = %d", got)
+	}
+	if got, _ := s.GetDocumentID("甲"); got != live {
+		t.Errorf("live document purged")
+	}
+	if ids, _ := s.GetDeletedDocumentIDs(); len(ids) != 0 {
+		t.Errorf("GetDeletedDocumentIDs after purge = %v", ids)
+	}
+	if err := DBAddDocument(s, "乙", "新的正文"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.GetDocumentID("乙"); got == 0 || got == id {
+		t.Errorf("GetDocumentID of new document = %d", got)
+	}
+	if n, _ := s.GetDocumentCount(); n != 3 {
+		t.Errorf("GetDocumentCount after purge = %d, want 3", n)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestMemoryStoreDelete(t *testing.T) {
+	s := NewMemoryStore()
+	testPurgeDocument(t, s, testDeleteDocument(t, s))
+}
+
+func TestFileStoreDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wiser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "wiser.db")
+
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := testDeleteDocument(t, s)
+	s.Close()
+	// 重新打开后删除标记依然存在
+	s, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.GetDocumentCount(); n != 2 {
+		t.Errorf("GetDocumentCount after reopen = %d, want 2", n)
+	}
+	testPurgeDocument(t, s, id)
+	s.Close()
+	s, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if ids, _ := s.GetDeletedDocumentIDs(); len(ids) != 0 {
+		t.Errorf("GetDeletedDocumentIDs after reopen = %v", ids)
+	}
+	if n, _ := s.GetDocumentCount(); n != 3 {
+		t.Errorf("GetDocumentCount after reopen = %d, want 3", n)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wiser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "wiser.db")
+
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开后数据依然存在
+	s, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if n, _ := s.GetDocumentCount(); n != 2 {
+		t.Errorf("GetDocumentCount after reopen = %d, want 2", n)
+	}
+	id, _ := s.GetDocumentID("物理")
+	if n, _ := s.GetDocumentLength(id); n != 2 {
+		t.Errorf("GetDocumentLength after reopen = %d, want 2", n)
+	}
+	tokenID, _, _ := s.GetTokenID("数学")
+	count, postings, _ := s.GetPostings(tokenID)
+	if count != 3 || !bytes.Equal(postings, []byte{1, 2, 3}) {
+		t.Errorf("GetPostings after reopen = %d, %v", count, postings)
+	}
+	if n, _ := s.GetTokenMaxTermFrequency(tokenID); n != 7 {
+		t.Errorf("GetTokenMaxTermFrequency after reopen = %d, want 7", n)
+	}
+	if v, _ := s.GetSettings("compress"); v != "golomb" {
+		t.Errorf("GetSettings after reopen = %q, want golomb", v)
+	}
+}
+
+func TestFileStoreDamagedTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wiser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tails := map[string][]byte{
+		"zero":      make([]byte, 16),
+		"oversized": {0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f, 1, 2, 3, 4, 5},
+	}
+	for name, tail := range tails {
+		path := filepath.Join(dir, name+".db")
+		s, err := NewFileStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := DBAddDocument(s, "数学", "数学是研究数量的学科"); err != nil {
+			t.Fatal(err)
+		}
+		s.Close()
+		info, _ := os.Stat(path)
+		f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		f.Write(tail)
+		f.Close()
+
+		// 损坏的部分被截断，之前的记录依然有效
+		s, err = NewFileStore(path)
+		if err != nil {
+			t.Fatalf("%s: NewFileStore: %v", name, err)
+		}
+		if id, _ := s.GetDocumentID("数学"); id == 0 {
+			t.Errorf("%s: document lost", name)
+		}
+		if after, _ := os.Stat(path); after.Size() != info.Size() {
+			t.Errorf("%s: size after reopen = %d, want %d", name, after.Size(), info.Size())
+		}
+		s.Close()
+	}
+}
+
+// 检查文档的元数据
+func testDocumentMetadata(t *testing.T, s Store) int {
+	if err := DBAddDocument(s, "甲", "正文"); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := s.GetDocumentID("甲")
+	if m, err := s.GetDocumentMetadata(id); err != nil || len(m) != 0 {
+		t.Fatalf("GetDocumentMetadata of new document = %v, %v", m, err)
+	}
+	s.UpdateDocumentMetadata(id, "path", "a.txt")
+	s.UpdateDocumentMetadata(id, "path", "b.txt")
+	s.UpdateDocumentMetadata(id, "links", "乙\n丙")
+	s.UpdateDocumentMetadata(id, "empty", "x")
+	s.UpdateDocumentMetadata(id, "empty", "")
+	want := map[string]string{"path": "b.txt", "links": "乙\n丙"}
+	if m, _ := s.GetDocumentMetadata(id); !reflect.DeepEqual(m, want) {
+		t.Errorf("GetDocumentMetadata = %v, want %v", m, want)
+	}
+	return id
+}
+
+func TestMemoryStoreMetadata(t *testing.T) {
+	testDocumentMetadata(t, NewMemoryStore())
+}
+
+func TestFileStoreMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wiser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "wiser.db")
+
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := testDocumentMetadata(t, s)
+	s.Close()
+	s, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if m, _ := s.GetDocumentMetadata(id); m["path"] != "b.txt" || len(m) != 2 {
+		t.Errorf("GetDocumentMetadata after reopen = %v", m)
+	}
+	// 清除文档时元数据也一起清除
+	s.DeleteDocument(id)
+	s.PurgeDocument(id)
+	if m, _ := s.GetDocumentMetadata(id); len(m) != 0 {
+		t.Errorf("GetDocumentMetadata after purge = %v", m)
+	}
+}
+
+// 检查别名
+func testAlias(t *testing.T, s Store) {
+	if target, err := s.GetAliasTarget("江户"); err != nil || target != "" {
+		t.Fatalf("GetAliasTarget of missing alias = %q, %v", target, err)
+	}
+	s.ReplaceAlias("江户", "京都")
+	s.ReplaceAlias("江户", "东京")
+	s.ReplaceAlias("大阪府", "大阪")
+	s.ReplaceAlias("大阪府", "")
+	if target, _ := s.GetAliasTarget("江户"); target != "东京" {
+		t.Errorf("GetAliasTarget = %q, want 东京", target)
+	}
+	if target, _ := s.GetAliasTarget("大阪府"); target != "" {
+		t.Errorf("GetAliasTarget of removed alias = %q", target)
+	}
+}
+
+func TestMemoryStoreAlias(t *testing.T) {
+	testAlias(t, NewMemoryStore())
+}
+
+func TestFileStoreAlias(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wiser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "wiser.db")
+
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testAlias(t, s)
+	s.Close()
+	s, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if target, _ := s.GetAliasTarget("江户"); target != "东京" {
+		t.Errorf("GetAliasTarget after reopen = %q, want 东京", target)
+	}
+	if target, _ := s.GetAliasTarget("大阪府"); target != "" {
+		t.Errorf("GetAliasTarget of removed alias after reopen = %q", target)
+	}
+}
+
+func TestFileStoreCompact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wiser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "wiser.db")
+
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := testDeleteDocument(t, s)
+	testAlias(t, s)
+	live, _ := s.GetDocumentID("甲")
+	s.UpdateDocumentLength(live, 2)
+	s.StoreToken("数学", nil)
+	tokenID, _, _ := s.GetTokenID("数学")
+	s.UpdatePostings(tokenID, 3, 7, []byte{1, 2, 3})
+	s.ReplaceSettings("compress", "golomb")
+	last, _ := s.GetDocumentID("丙")
+	s.DeleteDocument(last)
+	s.PurgeDocument(last)
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 压缩后数据依然存在，已清除的文档的编号不会再次分配
+	check := func(s *FileStore) {
+		t.Helper()
+		if n, _ := s.GetDocumentCount(); n != 1 {
+			t.Errorf("GetDocumentCount = %d, want 1", n)
+		}
+		if deleted, _ := s.IsDocumentDeleted(id); !deleted {
+			t.Errorf("IsDocumentDeleted(%d) = false", id)
+		}
+		if got, _ := s.GetDocumentID("丙"); got != 0 {
+			t.Errorf("GetDocumentID of purged document = %d", got)
+		}
+		if n, _ := s.GetDocumentLength(live); n != 2 {
+			t.Errorf("GetDocumentLength = %d, want 2", n)
+		}
+		if body, _ := s.GetDocumentBody(live); body != "甲的正文" {
+			t.Errorf("GetDocumentBody = %q", body)
+		}
+		tokenID, count, _ := s.GetTokenID("数学")
+		_, postings, _ := s.GetPostings(tokenID)
+		if count != 3 || !bytes.Equal(postings, []byte{1, 2, 3}) {
+			t.Errorf("GetPostings = %d, %v", count, postings)
+		}
+		if n, _ := s.GetTokenMaxTermFrequency(tokenID); n != 7 {
+			t.Errorf("GetTokenMaxTermFrequency = %d, want 7", n)
+		}
+		if v, _ := s.GetSettings("compress"); v != "golomb" {
+			t.Errorf("GetSettings = %q, want golomb", v)
+		}
+		if target, _ := s.GetAliasTarget("江户"); target != "东京" {
+			t.Errorf("GetAliasTarget = %q, want 东京", target)
+		}
+	}
+	check(s)
+	s.Close()
+	s, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	check(s)
+	if err := DBAddDocument(s, "丁", "丁的正文"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.GetDocumentID("丁"); got <= last {
+		t.Errorf("GetDocumentID of new document = %d, want > %d", got, last)
+	}
+}
+
+func TestFileStoreSizeBounded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wiser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "wiser.db")
+
+	// 反复更新倒排列表之后关闭，文件只保留最后的倒排列表
+	postings := bytes.Repeat([]byte{1}, 1024)
+	for i := 0; i < 3; i++ {
+		s, err := NewFileStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.StoreToken("数学", nil); err != nil {
+			t.Fatal(err)
+		}
+		id, _, _ := s.GetTokenID("数学")
+		for j := 0; j < 100; j++ {
+			postings[0] = byte(j)
+			if err := s.UpdatePostings(id, j, 1, postings); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 2*int64(len(postings)) {
+			t.Errorf("file size after %d rounds = %d", i+1, info.Size())
+		}
+	}
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	id, count, _ := s.GetTokenID("数学")
+	if _, got, _ := s.GetPostings(id); count != 99 || !bytes.Equal(got, postings) {
+		t.Errorf("GetPostings after compaction = %d, %d bytes", count, len(got))
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("%d files left in directory", len(files))
+	}
+}
@@ -7,15 +7,39 @@ CREATE TABLE IF NOT EXISTS settings (
 CREATE TABLE IF NOT EXISTS documents (
     id INT(4) PRIMARY KEY AUTO_INCREMENT NOT NULL,
     title   TEXT NOT NULL,
-    body    TEXT NOT NULL
+    body    TEXT NOT NULL,
+    token_count INT NOT NULL DEFAULT 0,
+    deleted     TINYINT NOT NULL DEFAULT 0
+)ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 为已有的 documents 表添加文档长度（词元数）
+-- ALTER TABLE documents ADD COLUMN token_count INT NOT NULL DEFAULT 0;
+-- 为已有的 documents 表添加删除标记
+-- ALTER TABLE documents ADD COLUMN deleted TINYINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS document_metadata (
+    id INT(4) PRIMARY KEY AUTO_INCREMENT NOT NULL,
+    document_id INT NOT NULL,
+    `key`   VARCHAR(255) NOT NULL,
+    `value` MEDIUMTEXT NOT NULL,
+    UNIQUE KEY document_key_index (document_id, `key`)
+)ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS aliases (
+    id INT(4) PRIMARY KEY AUTO_INCREMENT NOT NULL,
+    alias  VARCHAR(255) NOT NULL,
+    target TEXT NOT NULL,
+    UNIQUE KEY alias_index (alias)
 )ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
 CREATE TABLE IF NOT EXISTS tokens (
     id INT(4) PRIMARY KEY AUTO_INCREMENT NOT NULL,
     token      TEXT NOT NULL,
     docs_count INT NOT NULL,
+    max_tf     INT NOT NULL DEFAULT 0,
     postings   BLOB NOT NULL
 )ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+-- ALTER TABLE tokens ADD COLUMN max_tf INT NOT NULL DEFAULT 0;
 
 CREATE UNIQUE INDEX token_index ON tokens(token);
 CREATE UNIQUE INDEX title_index ON documents(title);
\ No newline at end of file
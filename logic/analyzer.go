@@ -0,0 +1,275 @@
+package logic
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/read-talk/wiser/util"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// 分析文本得到的词元
+type Token struct {
+	Text     string // 词元
+	Position int    // 词元在文本中的位置，短语检索时用位置之差判断词元是否相邻
+}
+
+// 在分割词元之前对文本进行变换，例如去除标记、规范化字符
+type CharFilter interface {
+	Filter(text []rune) []rune
+}
+
+// 将文本分割为词元
+type Tokenizer interface {
+	Tokenize(text []rune) []Token
+}
+
+// 对分割出来的词元进行变换或过滤
+type TokenFilter interface {
+	Filter(tokens []Token) []Token
+}
+
+// 将函数用作字符过滤器
+type CharFilterFunc func(text []rune) []rune
+
+func (f CharFilterFunc) Filter(text []rune) []rune {
+	return f(text)
+}
+
+// 将函数用作词元过滤器
+type TokenFilterFunc func(tokens []Token) []Token
+
+func (f TokenFilterFunc) Filter(tokens []Token) []Token {
+	return f(tokens)
+}
+
+// 将文本转换为词元序列
+// 建立索引和处理查询时使用同一个分析器，查询中的词元才能与索引中的词元一致
+type Analyzer interface {
+	// 分析器的名称，记录在 settings 表中，用于重新打开索引时选择相同的分析器
+	Name() string
+	// 分析文本，返回按位置排列的词元
+	Analyze(text string) []Token
+}
+
+// 依次使用字符过滤器、分词器和词元过滤器处理文本的分析器
+type PipelineAnalyzer struct {
+	AnalyzerName string
+	CharFilters  []CharFilter
+	Tokenizer    Tokenizer
+	TokenFilters []TokenFilter
+}
+
+func (a *PipelineAnalyzer) Name() string {
+	return a.AnalyzerName
+}
+
+func (a *PipelineAnalyzer) Analyze(text string) []Token {
+	runes := []rune(text)
+	for _, f := range a.CharFilters {
+		runes = f.Filter(runes)
+	}
+	tokens := a.Tokenizer.Tokenize(runes)
+	for _, f := range a.TokenFilters {
+		tokens = f.Filter(tokens)
+	}
+	return tokens
+}
+
+// 对文本进行 NFKC 规范化和大小写折叠的字符过滤器
+// 全角和半角字符、兼容字符以及大小写不同的字符都被转换为相同的字符
+type NormalizeFilter struct{}
+
+func (NormalizeFilter) Filter(text []rune) []rune {
+	s := norm.NFKC.String(string(text))
+	// 大小写折叠后的字符可能不再是 NFKC 的形式，需要再次规范化
+	s = norm.NFKC.String(cases.Fold().String(s))
+	return []rune(s)
+}
+
+// 将文本分割为 N-gram 的分词器
+// 跳过空白和标点等不属于索引对象的字符，不足 N 个字符的部分不作为词元
+// 词元的位置是其第一个字符在文本中的下标
+type NgramTokenizer struct {
+	N       int               // N-gram 中 N 的取值
+	Ignored func(c rune) bool // 判断字符是否不属于索引对象，为 nil 时使用 util.IsIgnoredChar
+}
+
+func (t NgramTokenizer) Tokenize(text []rune) []Token {
+	ignored := t.Ignored
+	if ignored == nil {
+		ignored = util.IsIgnoredChar
+	}
+	var tokens []Token
+	start := 0
+	for {
+		// 每次从字符串中取出长度为 N-gram 的词元
+		tokenLen, position := util.NgramNextFunc(text, &start, t.N, ignored)
+		if tokenLen == 0 {
+			break
+		}
+		if tokenLen < t.N {
+			continue
+		}
+		tokens = append(tokens, Token{Text: string(text[position : position+t.N]), Position: position})
+	}
+	return tokens
+}
+
+// 同时处理拼音文字和汉字等表意文字的分词器
+// 拉丁字母等拼音文字和数字连续出现的部分作为一个单词，转换为小写后作为词元；
+// 汉字、假名等连续出现的部分分割为 N-gram，不足 N 个字符的部分不作为词元。
+// 单词和 N-gram 的长度不同，因此词元的位置按词元的序号计算，相邻的词元的位置之差为 1，
+// 被分隔符或不足 N 个字符的部分隔开的词元之间空出一个位置。
+type MixedTokenizer struct {
+	N int // N-gram 中 N 的取值
+}
+
+func (t MixedTokenizer) Tokenize(text []rune) []Token {
+	var p tokenPositions
+	scanScripts(text, p.add, func(run []rune) {
+		if len(run) < t.N {
+			p.skip()
+			return
+		}
+		for j := 0; j+t.N <= len(run); j++ {
+			p.add(string(run[j : j+t.N]))
+		}
+	}, p.skip)
+	return p.tokens
+}
+
+// 按序号为词元分配位置
+// 跳过的文字使位置额外增加 1，这样被跳过的文字隔开的词元不会被当作相邻的词元
+type tokenPositions struct {
+	tokens []Token
+	next   int // 下一个词元的位置
+}
+
+func (p *tokenPositions) add(text string) {
+	p.tokens = append(p.tokens, Token{Text: text, Position: p.next})
+	p.next++
+}
+
+func (p *tokenPositions) skip() {
+	p.next++
+}
+
+// 将文本分为单词和汉字等其他文字连续出现的部分，跳过不属于索引对象的字符
+// word 处理转换为小写后的单词
+// run 处理其他文字连续出现的部分
+// skip 每遇到一段连续的不属于索引对象的字符时调用
+func scanScripts(text []rune, word func(w string), run func(r []rune), skip func()) {
+	for i := 0; i < len(text); {
+		r := text[i]
+		switch {
+		case isWordChar(r):
+			end := i + 1
+			for end < len(text) && (isWordChar(text[end]) || unicode.IsMark(text[end])) {
+				end++
+			}
+			word(strings.ToLower(string(text[i:end])))
+			i = end
+		case util.IsSeparatorChar(r):
+			end := i + 1
+			for end < len(text) && util.IsSeparatorChar(text[end]) {
+				end++
+			}
+			skip()
+			i = end
+		default:
+			end := i + 1
+			for end < len(text) && !isWordChar(text[end]) && !util.IsSeparatorChar(text[end]) {
+				end++
+			}
+			run(text[i:end])
+			i = end
+		}
+	}
+}
+
+// 汉字和假名中使用的通用文字（Common）中的字符，例如长音符号和叠字符号
+// 这些字符是字母，但应当与前后的汉字和假名一起处理
+var cjkCommonLetters = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x3005, Hi: 0x3006, Stride: 1}, // 々 〆
+		{Lo: 0x303b, Hi: 0x303c, Stride: 1}, // 〻 〼
+		{Lo: 0x30fc, Hi: 0x30fc, Stride: 1}, // ー
+		{Lo: 0xff70, Hi: 0xff70, Stride: 1}, // 半角的ｰ
+	},
+}
+
+// 是否是构成单词的字符，即数字和汉字、假名、谚文以外的文字
+func isWordChar(r rune) bool {
+	if unicode.IsDigit(r) {
+		return true
+	}
+	return unicode.IsLetter(r) && !unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana,
+		unicode.Hangul, unicode.Bopomofo, cjkCommonLetters)
+}
+
+// 分析器的名称
+const (
+	AnalyzerNgram  = "ngram"  // 不规范化文本，跳过字母和数字的 N-gram 分析器，也是在记录分析器之前建立的索引所使用的分析器
+	AnalyzerNgram2 = "ngram2" // 规范化文本，只跳过分隔符的 N-gram 分析器
+	AnalyzerMixed  = "mixed"  // 将单词和数字作为词元，其他部分分割为 N-gram
+	AnalyzerDict   = "dict"   // 将单词和数字作为词元，其他部分根据词典分词
+)
+
+// 新建使用 N-gram 分词器的默认分析器
+// 对文本进行规范化，字母和数字也分割为 N-gram
+func NewNgramAnalyzer(n int) *PipelineAnalyzer {
+	return &PipelineAnalyzer{
+		AnalyzerName: AnalyzerNgram2,
+		CharFilters:  []CharFilter{NormalizeFilter{}},
+		Tokenizer:    NgramTokenizer{N: n, Ignored: util.IsSeparatorChar},
+	}
+}
+
+// 新建以前的版本使用的 N-gram 分析器
+// 不对文本进行规范化，跳过 ASCII 字母、数字以及 util.IsIgnoredChar 中列出的标点
+func NewLegacyNgramAnalyzer(n int) *PipelineAnalyzer {
+	return &PipelineAnalyzer{
+		AnalyzerName: AnalyzerNgram,
+		Tokenizer:    NgramTokenizer{N: n},
+	}
+}
+
+// 根据名称新建分析器
+// n N-gram 中 N 的取值
+// dictionary path 分词使用的词典文件的路径，只用于 dict 分析器
+func NewAnalyzer(name string, n int, dictionaryPath string) (Analyzer, error) {
+	switch name {
+	case AnalyzerNgram:
+		return NewLegacyNgramAnalyzer(n), nil
+	case AnalyzerNgram2:
+		return NewNgramAnalyzer(n), nil
+	case AnalyzerMixed:
+		return &PipelineAnalyzer{
+			AnalyzerName: AnalyzerMixed,
+			CharFilters:  []CharFilter{NormalizeFilter{}},
+			Tokenizer:    MixedTokenizer{N: n},
+		}, nil
+	case AnalyzerDict:
+		if dictionaryPath == "" {
+			return nil, fmt.Errorf("analyzer %s requires a dictionary file", name)
+		}
+		dict, err := LoadDictionary(dictionaryPath)
+		if err != nil {
+			return nil, err
+		}
+		return NewDictAnalyzer(dict), nil
+	default:
+		return nil, fmt.Errorf("unknown analyzer: %s", name)
+	}
+}
+
+// 获取运行环境使用的分析器，没有指定时使用 N-gram 分析器
+func (env *WiserEnv) analyzer() Analyzer {
+	if env.Analyzer == nil {
+		return NewNgramAnalyzer(env.TokenLen)
+	}
+	return env.Analyzer
+}
@@ -0,0 +1,274 @@
+package logic
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/read-talk/wiser/dao"
+)
+
+func TestNgramTokenizer(t *testing.T) {
+	got := NewNgramAnalyzer(2).Analyze("东京都的 天气。ab")
+	want := []Token{{"东京", 0}, {"京都", 1}, {"都的", 2}, {"天气", 5}, {"ab", 8}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Analyze = %v, want %v", got, want)
+	}
+	got = NewNgramAnalyzer(3).Analyze("东京都的 天气")
+	want = []Token{{"东京都", 0}, {"京都的", 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Analyze with N=3 = %v, want %v", got, want)
+	}
+}
+
+func TestLegacyNgramAnalyzer(t *testing.T) {
+	// 以前的版本跳过 ASCII 字母和数字，不规范化全角字符
+	got := NewLegacyNgramAnalyzer(2).Analyze("东京2020年ab奥运ＡＢ")
+	want := []Token{{"东京", 0}, {"奥运", 9}, {"运Ａ", 10}, {"ＡＢ", 11}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Analyze = %v, want %v", got, want)
+	}
+}
+
+func TestLegacyNgramSetting(t *testing.T) {
+	// 以前的版本建立的索引，没有记录分析器或者记录了 ngram
+	for _, recorded := range []bool{false, true} {
+		store := dao.NewMemoryStore()
+		env := NewEnv(store, 2048)
+		env.Analyzer = NewLegacyNgramAnalyzer(2)
+		addDocuments(t, env, "甲", "东京2020年奥运会")
+		if !recorded {
+			if err := store.ReplaceSettings(SettingAnalyzer, ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		env = NewEnv(store, 2048)
+		hits, _, err := env.Search(context.Background(), "东京2020年", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hits) != 1 || hits[0].Title != "甲" {
+			t.Errorf("Search(东京2020年) with recorded=%v = %v", recorded, hits)
+		}
+		if name := env.analyzer().Name(); name != AnalyzerNgram {
+			t.Errorf("analyzer with recorded=%v = %s, want %s", recorded, name, AnalyzerNgram)
+		}
+	}
+}
+
+func TestNormalizeFilter(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"ＡＢＣ１２３", "abc123"},
+		{"ｶﾀｶﾅ", "カタカナ"},
+		{"Straße", "strasse"},
+		{"①㍻", "1平成"},
+		{"ΣΊΣΥΦΟΣ", "σίσυφοσ"},
+	}
+	for _, tt := range tests {
+		if got := string(NormalizeFilter{}.Filter([]rune(tt.text))); got != tt.want {
+			t.Errorf("Filter(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestIgnoredChars(t *testing.T) {
+	got := NewNgramAnalyzer(2).Analyze("东京「大阪」・京都——神户\u3000名古屋…札幌☆福冈\u200b仙台")
+	var texts []string
+	for _, token := range got {
+		texts = append(texts, token.Text)
+	}
+	want := []string{"东京", "大阪", "京都", "神户", "名古", "古屋", "札幌", "福冈", "仙台"}
+	if !reflect.DeepEqual(texts, want) {
+		t.Errorf("Analyze = %v, want %v", texts, want)
+	}
+}
+
+func TestNormalizedSearch(t *testing.T) {
+	env := newTestEnv()
+	env.Analyzer, _ = NewAnalyzer(AnalyzerMixed, 2, "")
+	addDocuments(t, env, "甲", "ＩＰＨＯＮＥ\u3000１２发布", "乙", "iPhone 12 Pro")
+	for _, q := range []string{"iphone", "IPHONE", "ｉｐｈｏｎｅ", "12"} {
+		if ids := searchIDs(t, env, q); len(ids) != 2 {
+			t.Errorf("search(%q) = %v, want 2 documents", q, ids)
+		}
+	}
+}
+
+// 将繁体字转换为简体字，并去除包含“的”的词元的分析器
+func newTestAnalyzer() *PipelineAnalyzer {
+	return &PipelineAnalyzer{
+		AnalyzerName: "test",
+		CharFilters: []CharFilter{CharFilterFunc(func(text []rune) []rune {
+			return []rune(strings.NewReplacer("東", "东", "氣", "气").Replace(string(text)))
+		})},
+		Tokenizer: NgramTokenizer{N: 2},
+		TokenFilters: []TokenFilter{TokenFilterFunc(func(tokens []Token) []Token {
+			var ret []Token
+			for _, t := range tokens {
+				if !strings.Contains(t.Text, "的") {
+					ret = append(ret, t)
+				}
+			}
+			return ret
+		})},
+	}
+}
+
+func TestPipelineAnalyzer(t *testing.T) {
+	got := newTestAnalyzer().Analyze("東京的天氣")
+	want := []Token{{"东京", 0}, {"天气", 3}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Analyze = %v, want %v", got, want)
+	}
+
+	// 建立索引和处理查询时使用相同的分析器
+	env := newTestEnv()
+	env.Analyzer = newTestAnalyzer()
+	addDocuments(t, env, "甲", "东京的天气", "乙", "京都的寺庙")
+	if ids := searchIDs(t, env, "東京"); !reflect.DeepEqual(ids, []int{1}) {
+		t.Errorf("search(東京) = %v, want [1]", ids)
+	}
+	if id, _, _ := env.Store.GetTokenID("京的"); id != 0 {
+		t.Errorf("filtered token 京的 stored")
+	}
+	if n, _ := env.Store.GetDocumentLength(1); n != 2 {
+		t.Errorf("document length = %d, want 2", n)
+	}
+}
+
+func TestAnalyzerSetting(t *testing.T) {
+	store := dao.NewMemoryStore()
+	env := NewEnv(store, 2048)
+	env.Analyzer = newTestAnalyzer()
+	addDocuments(t, env, "甲", "东京的天气")
+	if v, _ := store.GetSettings(SettingAnalyzer); v != "test" {
+		t.Fatalf("analyzer setting = %q, want test", v)
+	}
+
+	// 重新打开索引时使用记录的分析器，无法新建时返回错误
+	env = NewEnv(store, 2048)
+	if _, _, err := env.Search(context.Background(), "东京", nil); err == nil {
+		t.Errorf("Search with unknown analyzer succeeded")
+	}
+	env = NewEnv(store, 2048)
+	env.Analyzer = newTestAnalyzer()
+	if ids := searchIDs(t, env, "東京"); !reflect.DeepEqual(ids, []int{1}) {
+		t.Errorf("search(東京) = %v, want [1]", ids)
+	}
+
+	// 记录分析器之前建立的索引使用 N-gram 分析器
+	store = dao.NewMemoryStore()
+	if err := dao.DBAddDocument(store, "甲", "东京的天气"); err != nil {
+		t.Fatal(err)
+	}
+	env = NewEnv(store, 2048)
+	env.Analyzer = newTestAnalyzer()
+	if err := env.syncSettings(); err != nil {
+		t.Fatal(err)
+	}
+	if name := env.analyzer().Name(); name != AnalyzerNgram {
+		t.Errorf("analyzer of old index = %s, want %s", name, AnalyzerNgram)
+	}
+}
+
+func TestMixedTokenizer(t *testing.T) {
+	analyzer, err := NewAnalyzer(AnalyzerMixed, 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := analyzer.Analyze("苹果的iPhone 12手机，售价 5999元。Café")
+	// 分隔符和不足 N 个字符的“元”各占一个位置
+	want := []Token{{"苹果", 0}, {"果的", 1}, {"iphone", 2}, {"12", 4}, {"手机", 5},
+		{"售价", 7}, {"5999", 9}, {"café", 12}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Analyze = %v, want %v", got, want)
+	}
+
+	// 长音符号与前后的假名一起分割为 N-gram
+	got = analyzer.Analyze("コーヒー店")
+	want = []Token{{"コー", 0}, {"ーヒ", 1}, {"ヒー", 2}, {"ー店", 3}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Analyze = %v, want %v", got, want)
+	}
+}
+
+func TestMixedSearch(t *testing.T) {
+	env := newTestEnv()
+	env.Analyzer, _ = NewAnalyzer(AnalyzerMixed, 2, "")
+	env.EnablePharseSearch = 1
+	addDocuments(t, env,
+		"甲", "苹果发布了iPhone 12手机",
+		"乙", "Python是一种编程语言",
+		"丙", "iPhone手机有12种颜色",
+		"丁", "Apple 的 iPhone",
+		"戊", "Apple iPhone")
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"python", []int{2}},
+		{"PYTHON 语言", []int{2}},
+		{"iphone", []int{1, 3, 4, 5}},
+		{`"iPhone 12手机"`, []int{1}},
+		// 被跳过的文字隔开的单词不相邻
+		{`"apple iphone"`, []int{5}},
+		{`"iPhone手机"`, []int{3}},
+		{"12", []int{1, 3}},
+	}
+	for _, tt := range tests {
+		ids := searchIDs(t, env, tt.query)
+		sort.Ints(ids)
+		if !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("search(%q) = %v, want %v", tt.query, ids, tt.want)
+		}
+	}
+}
+
+func TestTokenLenSetting(t *testing.T) {
+	store := dao.NewMemoryStore()
+	env := NewEnv(store, 2048)
+	env.TokenLen = 3
+	addDocuments(t, env, "甲", "东京都的天气", "乙", "京都府")
+	if v, _ := store.GetSettings(SettingTokenLen); v != "3" {
+		t.Fatalf("token length setting = %q, want 3", v)
+	}
+
+	// 使用建立索引时的 N 重新新建分析器
+	for _, analyzer := range []Analyzer{nil, NewNgramAnalyzer(2)} {
+		env = NewEnv(store, 2048)
+		env.Analyzer = analyzer
+		hits, _, err := env.Search(context.Background(), "东京都", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hits) != 1 || hits[0].Title != "甲" || env.TokenLen != 3 {
+			t.Errorf("Search(东京都) = %v with N=%d", hits, env.TokenLen)
+		}
+	}
+	// 无法重新新建的分析器返回错误
+	env = NewEnv(store, 2048)
+	env.Analyzer = newTestAnalyzer()
+	if _, _, err := env.Search(context.Background(), "东京都", nil); err == nil {
+		t.Error("Search with analyzer of different N succeeded")
+	}
+
+	// 记录 N 之前建立的索引使用 NGram
+	store = dao.NewMemoryStore()
+	if err := dao.DBAddDocument(store, "甲", "东京的天气"); err != nil {
+		t.Fatal(err)
+	}
+	env = NewEnv(store, 2048)
+	env.TokenLen = 3
+	if err := env.syncSettings(); err != nil {
+		t.Fatal(err)
+	}
+	if env.TokenLen != NGram {
+		t.Errorf("N of old index = %d, want %d", env.TokenLen, NGram)
+	}
+}
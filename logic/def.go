@@ -1,21 +1,36 @@
 package logic
 
+import (
+	"fmt"
+
+	"github.com/read-talk/wiser/dao"
+)
+
 const (
-	// bi-gram
+	// 新建索引时 N-gram 中 N 的默认值（bi-gram），建立索引时使用的值记录在 settings 表中
 	NGram = 2
 )
 
 type Page struct {
-	Title string `xml:"title"`
-	Text  string `xml:"revision>text"`
+	Title     string        `xml:"title"`
+	NS        int           `xml:"ns"`       // 名字空间，0 是条目所在的主名字空间
+	ID        int           `xml:"id"`       // 页面编号
+	Redirect  *PageRedirect `xml:"redirect"` // 重定向页面指向的页面，不是重定向页面时为 nil
+	Timestamp string        `xml:"revision>timestamp"`
+	Text      string        `xml:"revision>text"`
 }
 
-// 倒排列表（以文档编号和位置信息为元素的链表结构）
+// 重定向页面的目标
+type PageRedirect struct {
+	Title string `xml:"title,attr"`
+}
+
+// 倒排列表（以文档编号和位置信息为元素的列式结构）
+// 第 i 个文档的位置信息为 Positions[Offsets[i]:Offsets[i+1]]
 type PostingsList struct {
-	DocumentID     int           // 文档编号
-	Positions      []int         // 位置信息的数组
-	PositionsCount int           // 位置信息的条数
-	Next           *PostingsList // 指向下一个倒排列表
+	DocumentIDs []int // 按升序排列的文档编号
+	Offsets     []int // 各文档的位置信息在 Positions 中的起始下标，比文档数多一个元素
+	Positions   []int // 所有文档的位置信息
 }
 
 // 倒排索引（以词元编号为键，以倒排列表为值的关联数组）
@@ -32,12 +47,48 @@ type InvertedIndexHash struct {
 	Items   []*InvertedIndexValue
 }
 
+// 新建一个空的倒排索引
+func NewInvertedIndexHash() *InvertedIndexHash {
+	return &InvertedIndexHash{
+		HashMap: make(map[int]*InvertedIndexValue),
+		Items:   make([]*InvertedIndexValue, 0),
+	}
+}
+
 type CompressMethod struct {
-	CompressNone   bool // 不压缩
+	CompressNone   bool // 不压缩（JSON）
 	CompressGolomb bool // 使用 Golomb 编码压缩
+	CompressVByte  bool // 使用差分和可变字节编码的二进制格式
+}
+
+// 压缩方法的名称，与记录在 settings 表中的值相同
+func (c CompressMethod) String() string {
+	switch {
+	case c.CompressGolomb:
+		return "golomb"
+	case c.CompressVByte:
+		return "vbyte"
+	default:
+		return "none"
+	}
+}
+
+// 根据名称获取压缩方法
+func ParseCompressMethod(name string) (CompressMethod, error) {
+	switch name {
+	case "none":
+		return CompressMethod{CompressNone: true}, nil
+	case "golomb":
+		return CompressMethod{CompressGolomb: true}, nil
+	case "vbyte":
+		return CompressMethod{CompressVByte: true}, nil
+	default:
+		return CompressMethod{}, fmt.Errorf("unknown compress method: %s", name)
+	}
 }
 
 type WiserEnv struct {
+	Store                   dao.Store          // 存储文档、词元和倒排列表的后端
 	TokenLen                int                // 词元的长度。NGram中N的取值
 	Compress                CompressMethod     // 压缩倒排列表等数据的方法
 	EnablePharseSearch      int                // 是否进行短语检索
@@ -45,4 +96,14 @@ type WiserEnv struct {
 	IIBufferCount           int                // 用户更新倒排索引的缓冲区中的文档数
 	IIBufferUpdateThreshold int                // 缓冲区中文档数的阈值
 	IndexedCount            int                // 建立了索引的文档数
+	Scorer                  Scorer             // 计算检索结果得分的方法
+	Analyzer                Analyzer           // 将文档和查询转换为词元序列的分析器，为 nil 时使用 N-gram 分析器
+	DictionaryPath          string             // dict 分析器使用的词典文件的路径
+	RecordWikiFields        bool               // 导入 wiki 数据时是否将章节标题和链接记录为文档的元数据
+	WikiNamespaces          []int              // 导入 wiki 数据时要导入的名字空间，为空时只导入主名字空间
+	pendingTokenCount       int                // 缓冲区中的文档使文档总长度增加的词元数
+	bufferedDocuments       map[int]bool       // 缓冲区中已建立倒排索引的文档编号的集合
+	replacedDocuments       map[int]bool       // 正文被更新、合并时需要从存储器上的倒排列表中去除的文档编号的集合
+	settingsSynced          bool               // 是否已与存储器中记录的设置同步
+	disableSkip             bool               // 检索时不使用跳跃表跳过文档，用于比较跳跃表的效果
 }
@@ -0,0 +1,198 @@
+package logic
+
+import (
+	"fmt"
+
+	"github.com/read-talk/wiser/dao"
+)
+
+// 删除文档
+// 文档被标记为删除，之后的检索中不再出现，文档中出现的各词元的文档数也随之减少。
+// 倒排列表中该文档的数据在之后合并倒排索引或执行 Compact 时才被清除。
+// id 文档编号
+func (env *WiserEnv) DeleteDocument(id int) error {
+	err := env.syncSettings()
+	if err != nil {
+		return err
+	}
+	// 缓冲区中可能有该文档的倒排列表，先将其写入存储器，使存储器中的文档数准确
+	if env.IIBufferCount > 0 {
+		err = env.flushBuffer()
+		if err != nil {
+			return err
+		}
+	}
+	deleted, err := env.Store.IsDocumentDeleted(id)
+	if err != nil {
+		return err
+	}
+	if deleted {
+		return fmt.Errorf("document %d not found", id)
+	}
+	body, err := env.Store.GetDocumentBody(id)
+	if err != nil {
+		return fmt.Errorf("document %d not found", id)
+	}
+	length, err := env.Store.GetDocumentLength(id)
+	if err != nil {
+		return err
+	}
+	err = env.Store.DeleteDocument(id)
+	if err != nil {
+		return err
+	}
+
+	// 减少文档中出现的各词元的文档数
+	tokens, err := env.splitQueryToTokens(body)
+	if err != nil {
+		return err
+	}
+	for _, t := range tokens.Items {
+		if t.TokenID == 0 || t.DocsCount == 0 {
+			continue
+		}
+		err = env.Store.UpdateDocsCount(t.TokenID, t.DocsCount-1)
+		if err != nil {
+			return err
+		}
+	}
+	err = env.addTotalTokenCount(-length)
+	if err != nil {
+		return err
+	}
+	if env.IndexedCount > 0 {
+		env.IndexedCount--
+	}
+	return nil
+}
+
+// 根据标题删除文档，标题可以是别名
+func (env *WiserEnv) DeleteDocumentByTitle(title string) error {
+	id, err := env.GetDocumentIDByTitle(title)
+	if err != nil {
+		return err
+	}
+	if id == 0 {
+		return fmt.Errorf("document %q not found", title)
+	}
+	return env.DeleteDocument(id)
+}
+
+// 从所有倒排列表中清除已删除的文档，然后从存储器中清除这些文档
+// 存储器可以回收空间时，最后回收被覆盖和清除的数据占用的空间
+// 返回清除的文档数
+func (env *WiserEnv) Compact() (int, error) {
+	err := env.syncSettings()
+	if err != nil {
+		return 0, err
+	}
+	if env.IIBufferCount > 0 {
+		err = env.flushBuffer()
+		if err != nil {
+			return 0, err
+		}
+	}
+	deleted, err := env.deletedDocuments()
+	if err != nil {
+		return 0, err
+	}
+	err = env.purgeDocuments(deleted)
+	if err != nil {
+		return 0, err
+	}
+	if c, ok := env.Store.(dao.Compacter); ok {
+		err = c.Compact()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(deleted), nil
+}
+
+// 从所有倒排列表和存储器中清除 deleted 中的文档
+func (env *WiserEnv) purgeDocuments(deleted map[int]bool) error {
+	if len(deleted) == 0 {
+		return nil
+	}
+	ids, err := env.Store.GetTokenIDs()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		postings, _, err := env.FetchPostings(id)
+		if err != nil {
+			return err
+		}
+		postings, changed := filterPostings(postings, deleted)
+		if !changed {
+			continue
+		}
+		err = env.storePostings(id, postings)
+		if err != nil {
+			return err
+		}
+	}
+	for id := range deleted {
+		err = env.Store.PurgeDocument(id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 标题对应的文档已删除时，立即将其从倒排列表和存储器中清除
+// 只需处理该文档的正文中出现的词元
+func (env *WiserEnv) purgeDeletedTitle(title string) error {
+	id, err := env.Store.GetDocumentID(title)
+	if err != nil || id == 0 {
+		return err
+	}
+	deleted, err := env.Store.IsDocumentDeleted(id)
+	if err != nil || !deleted {
+		return err
+	}
+	body, err := env.Store.GetDocumentBody(id)
+	if err != nil {
+		return err
+	}
+	tokens, err := env.splitQueryToTokens(body)
+	if err != nil {
+		return err
+	}
+	excluded, err := env.deletedDocuments()
+	if err != nil {
+		return err
+	}
+	for _, t := range tokens.Items {
+		if t.TokenID == 0 {
+			continue
+		}
+		postings, _, err := env.FetchPostings(t.TokenID)
+		if err != nil {
+			return err
+		}
+		postings, changed := filterPostings(postings, excluded)
+		if !changed {
+			continue
+		}
+		err = env.storePostings(t.TokenID, postings)
+		if err != nil {
+			return err
+		}
+	}
+	return env.Store.PurgeDocument(id)
+}
+
+// 获取已删除的文档编号的集合
+func (env *WiserEnv) deletedDocuments() (map[int]bool, error) {
+	ids, err := env.Store.GetDeletedDocumentIDs()
+	if err != nil {
+		return nil, err
+	}
+	deleted := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		deleted[id] = true
+	}
+	return deleted, nil
+}
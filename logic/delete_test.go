@@ -0,0 +1,116 @@
+package logic
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDeleteDocument(t *testing.T) {
+	env := newTestEnv()
+	addDocuments(t, env,
+		"甲", "东京都的天气",
+		"乙", "京都的寺庙",
+		"丙", "东京的夜景")
+
+	if err := env.DeleteDocumentByTitle("甲"); err != nil {
+		t.Fatal(err)
+	}
+	// 立即从检索结果中排除
+	if got := searchIDs(t, env, "京都"); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("search after delete = %v, want [2]", got)
+	}
+	if got := searchIDs(t, env, "东京 OR 京都"); len(got) != 2 {
+		t.Errorf("search after delete = %v, want 2 documents", got)
+	}
+	_, docsCount, _ := env.Store.GetTokenID("京都")
+	if docsCount != 1 {
+		t.Errorf("docs_count of 京都 = %d, want 1", docsCount)
+	}
+	if n, _ := env.Store.GetDocumentCount(); n != 2 {
+		t.Errorf("GetDocumentCount = %d, want 2", n)
+	}
+	if value, _ := env.Store.GetSettings(SettingTotalTokenCount); value != "8" {
+		t.Errorf("%s = %s, want 8", SettingTotalTokenCount, value)
+	}
+	if err := env.DeleteDocumentByTitle("甲"); err == nil {
+		t.Error("deleting a deleted document succeeded")
+	}
+	if err := env.DeleteDocument(100); err == nil {
+		t.Error("deleting a missing document succeeded")
+	}
+
+	// 倒排列表中的数据在合并时清除
+	tokenID, _, _ := env.Store.GetTokenID("东京")
+	if postings, _, _ := env.FetchPostings(tokenID); postings.Len() != 2 {
+		t.Errorf("postings of 东京 purged before merge: %v", postings.DocumentIDs)
+	}
+	addDocuments(t, env, "丁", "东京和大阪")
+	postings, docsCount, _ := env.FetchPostings(tokenID)
+	if !reflect.DeepEqual(postings.DocumentIDs, []int{3, 4}) || docsCount != 2 {
+		t.Errorf("postings of 东京 after merge = %v, %d", postings.DocumentIDs, docsCount)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	for _, c := range []CompressMethod{{CompressNone: true}, {CompressGolomb: true}, {CompressVByte: true}} {
+		env := newTestEnv()
+		env.Compress = c
+		addDocuments(t, env,
+			"甲", "东京都的天气",
+			"乙", "京都的寺庙",
+			"丙", "东京的夜景")
+		env.DeleteDocumentByTitle("甲")
+		env.DeleteDocumentByTitle("乙")
+
+		n, err := env.Compact()
+		if err != nil || n != 2 {
+			t.Fatalf("%v: Compact = %d, %v; want 2", c, n, err)
+		}
+		ids, _ := env.Store.GetTokenIDs()
+		for _, id := range ids {
+			postings, docsCount, err := env.FetchPostings(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < postings.Len(); i++ {
+				if doc := postings.DocumentIDs[i]; doc != 3 {
+					t.Errorf("%v: token %d still has document %d", c, id, doc)
+				}
+			}
+			if docsCount != postings.Len() {
+				t.Errorf("%v: docs_count of token %d = %d, want %d", c, id, docsCount, postings.Len())
+			}
+		}
+		if id, _ := env.Store.GetDocumentID("甲"); id != 0 {
+			t.Errorf("%v: document 甲 not purged", c)
+		}
+		if n, _ := env.Compact(); n != 0 {
+			t.Errorf("%v: second Compact = %d, want 0", c, n)
+		}
+		if got := searchIDs(t, env, "东京"); !reflect.DeepEqual(got, []int{3}) {
+			t.Errorf("%v: search after compact = %v, want [3]", c, got)
+		}
+	}
+}
+
+func TestReAddDeletedDocument(t *testing.T) {
+	env := newTestEnv()
+	addDocuments(t, env, "甲", "东京都的天气", "乙", "京都的寺庙")
+	env.DeleteDocumentByTitle("甲")
+	// 删除后再次添加同名文档，旧的正文不会再被检索到
+	addDocuments(t, env, "甲", "大阪的美食")
+	id, _ := env.Store.GetDocumentID("甲")
+	if id != 3 {
+		t.Errorf("id of re-added document = %d, want 3", id)
+	}
+	if got := searchIDs(t, env, "东京"); len(got) != 0 {
+		t.Errorf("old body of re-added document found: %v", got)
+	}
+	if got := searchIDs(t, env, "大阪"); !reflect.DeepEqual(got, []int{3}) {
+		t.Errorf("search of new body = %v, want [3]", got)
+	}
+	_, docsCount, _ := env.Store.GetTokenID("京都")
+	if docsCount != 1 {
+		t.Errorf("docs_count of 京都 = %d, want 1", docsCount)
+	}
+}
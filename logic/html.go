@@ -0,0 +1,296 @@
+package logic
+
+import (
+	"errors"
+	"github.com/read-talk/wiser/util"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// 记录文档来源的元数据的键
+const (
+	MetadataSource = "source" // 导入的文件的路径
+	MetadataURL    = "url"    // 页面中声明的规范 URL
+)
+
+// 从 HTML 中提取的文本
+type HTMLText struct {
+	Title string // <title> 中的标题，没有时为正文中的第一个 <h1> 中的文字
+	Text  string // 正文
+	URL   string // <link rel="canonical"> 或 <meta property="og:url"> 中的 URL
+}
+
+// 不属于正文的元素，连同其中的内容一起去除
+var htmlDroppedElements = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Iframe: true, atom.Svg: true, atom.Nav: true, atom.Footer: true, atom.Aside: true,
+}
+
+// 块级元素，其前后换行
+var htmlBlockElements = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Blockquote: true, atom.Br: true, atom.Dd: true,
+	atom.Div: true, atom.Dl: true, atom.Dt: true, atom.Figcaption: true, atom.Figure: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Header: true, atom.Hr: true, atom.Li: true, atom.Main: true, atom.Ol: true, atom.P: true,
+	atom.Pre: true, atom.Section: true, atom.Table: true, atom.Td: true, atom.Th: true, atom.Tr: true,
+	atom.Ul: true,
+}
+
+var htmlSpaceRegexp = regexp.MustCompile(`[ \t\r\n\f]+`)
+
+// 从 HTML 中提取标题和正文，HTML 实体会被解码
+// 去除 script、style、nav、footer 等不属于正文的元素，有 <main> 或 <article> 时只提取其中的文字，
+// 没有时 <header> 是页面的页眉，也会被去除
+func ExtractHTML(r io.Reader) (*HTMLText, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	root := doc
+	for _, a := range []atom.Atom{atom.Main, atom.Article, atom.Body} {
+		if n := findHTMLElement(doc, a); n != nil {
+			root = n
+			break
+		}
+	}
+	dropHeader := root.DataAtom != atom.Main && root.DataAtom != atom.Article
+
+	ret := &HTMLText{}
+	if n := findHTMLElement(doc, atom.Title); n != nil {
+		ret.Title = htmlNodeText(n)
+	}
+	if ret.Title == "" {
+		if n := findHTMLContentElement(root, atom.H1, dropHeader); n != nil {
+			ret.Title = htmlNodeText(n)
+		}
+	}
+	ret.URL = htmlURL(doc)
+
+	var b strings.Builder
+	writeHTMLText(&b, root, dropHeader)
+	var lines []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	ret.Text = strings.Join(lines, "\n")
+	return ret, nil
+}
+
+// 返回第一个 a 元素，不存在时返回 nil
+func findHTMLElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if ret := findHTMLElement(c, a); ret != nil {
+			return ret
+		}
+	}
+	return nil
+}
+
+// 返回正文中的第一个 a 元素，不属于正文的元素中的不算，不存在时返回 nil
+func findHTMLContentElement(n *html.Node, a atom.Atom, dropHeader bool) *html.Node {
+	if isHTMLDropped(n, dropHeader) {
+		return nil
+	}
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if ret := findHTMLContentElement(c, a, dropHeader); ret != nil {
+			return ret
+		}
+	}
+	return nil
+}
+
+// 是否是不属于正文的元素
+// dropHeader 是否去除 <header>
+func isHTMLDropped(n *html.Node, dropHeader bool) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if htmlDroppedElements[n.DataAtom] || dropHeader && n.DataAtom == atom.Header {
+		return true
+	}
+	_, hidden := htmlAttr(n, "hidden")
+	return hidden
+}
+
+// 返回元素中的文字，连续的空白合并为一个空格
+func htmlNodeText(n *html.Node) string {
+	var b strings.Builder
+	writeHTMLText(&b, n, false)
+	return strings.TrimSpace(htmlSpaceRegexp.ReplaceAllString(b.String(), " "))
+}
+
+// 将节点中的文字写入 b，块级元素前后换行
+// dropHeader 是否去除 <header>
+func writeHTMLText(b *strings.Builder, n *html.Node, dropHeader bool) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(htmlSpaceRegexp.ReplaceAllString(n.Data, " "))
+		return
+	case html.ElementNode:
+		if isHTMLDropped(n, dropHeader) {
+			return
+		}
+		if n.DataAtom == atom.Pre {
+			// 预格式化的文字保留换行
+			b.WriteString("\n")
+			for _, line := range strings.Split(htmlRawText(n), "\n") {
+				b.WriteString(line + "\n")
+			}
+			return
+		}
+	}
+	block := n.Type == html.ElementNode && htmlBlockElements[n.DataAtom]
+	if block {
+		b.WriteString("\n")
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeHTMLText(b, c, dropHeader)
+	}
+	if block {
+		b.WriteString("\n")
+	}
+}
+
+// 返回节点中未经处理的文字
+func htmlRawText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(htmlRawText(c))
+	}
+	return b.String()
+}
+
+// 返回元素的属性值，以及是否有该属性
+func htmlAttr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// 返回页面中声明的规范 URL，没有时返回空字符串
+func htmlURL(n *html.Node) string {
+	var canonical, og string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Link:
+				if rel, _ := htmlAttr(n, "rel"); canonical == "" && strings.EqualFold(strings.TrimSpace(rel), "canonical") {
+					canonical, _ = htmlAttr(n, "href")
+				}
+			case atom.Meta:
+				if p, _ := htmlAttr(n, "property"); og == "" && p == "og:url" {
+					og, _ = htmlAttr(n, "content")
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	if canonical != "" {
+		return strings.TrimSpace(canonical)
+	}
+	return strings.TrimSpace(og)
+}
+
+// 读取 HTML 文件的来源
+// 以 <title> 作为文档标题，没有标题或标题与之前读取的页面相同时以相对路径作为文档标题
+// 从标准输入读取的页面没有标题时返回错误
+// 文件的绝对路径和页面中声明的 URL 记录为文档的元数据
+type HTMLSource struct {
+	dir    string
+	files  []string   // 尚未读取的文件的路径
+	titles usedTitles // 已读取的页面的标题
+}
+
+// 创建读取 HTML 文件的来源
+// path 文件的路径，为目录时读取其中的所有 HTML 文件，为 - 时从标准输入读取
+func NewHTMLSource(path string) (*HTMLSource, error) {
+	if path == "-" {
+		return &HTMLSource{files: []string{path}, titles: usedTitles{}}, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return &HTMLSource{dir: filepath.Dir(path), files: []string{path}, titles: usedTitles{}}, nil
+	}
+	files, err := walkFiles(path, isHTMLFile)
+	if err != nil {
+		return nil, err
+	}
+	return &HTMLSource{dir: path, files: files, titles: usedTitles{}}, nil
+}
+
+// 是否是 HTML 文件
+func isHTMLFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm", ".xhtml":
+		return true
+	}
+	return false
+}
+
+func (s *HTMLSource) Next() (*Document, error) {
+	if len(s.files) == 0 {
+		return nil, io.EOF
+	}
+	path := s.files[0]
+	s.files = s.files[1:]
+	f, err := util.OpenInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	text, err := ExtractHTML(f)
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{Title: text.Title, Body: text.Text, Metadata: map[string]string{}}
+	if path == "-" {
+		if doc.Title == "" {
+			return nil, errors.New("html from standard input has no <title> or <h1>")
+		}
+	} else {
+		doc.Metadata[MetadataSource], err = filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		doc.Title, err = s.titles.pick(doc.Title, s.dir, path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if text.URL != "" {
+		doc.Metadata[MetadataURL] = text.URL
+	}
+	return doc, nil
+}
+
+func (s *HTMLSource) Close() error {
+	s.files = nil
+	return nil
+}
@@ -0,0 +1,221 @@
+package logic
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testHTML = `<!DOCTYPE html>
+<html>
+<head>
+<title> 东京 &amp; 京都 </title>
+<link rel="canonical" href="https://example.com/tokyo">
+<style>body { color: red; }</style>
+<script>var s = "<p>脚本</p>";</script>
+</head>
+<body>
+<nav><a href="/">首页</a></nav>
+<h1>东京</h1>
+<div hidden>隐藏的文字</div>
+<p>东京是<b>日本</b>的首都&nbsp;&lt;都&gt;</p>
+<ul><li>千代田区</li><li>新宿区</li></ul>
+<pre>第一行
+  第二行</pre>
+<footer>版权所有</footer>
+</body>
+</html>`
+
+func TestExtractHTML(t *testing.T) {
+	got, err := ExtractHTML(strings.NewReader(testHTML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "东京 & 京都" {
+		t.Errorf("Title = %q", got.Title)
+	}
+	if got.URL != "https://example.com/tokyo" {
+		t.Errorf("URL = %q", got.URL)
+	}
+	want := "东京\n东京是日本的首都 <都>\n千代田区\n新宿区\n第一行\n第二行"
+	if got.Text != want {
+		t.Errorf("Text =\n%s\nwant\n%s", got.Text, want)
+	}
+
+	// 有 <main> 时只提取其中的文字，没有 <title> 时以 <h1> 作为标题
+	got, err = ExtractHTML(strings.NewReader(`<body><div>侧栏</div><main><h1>京都</h1><p>古都</p></main></body>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "京都" || got.Text != "京都\n古都" {
+		t.Errorf("Title = %q, Text = %q", got.Title, got.Text)
+	}
+
+	// 没有 <main> 和 <article> 时去除 <header>，<h1> 只从正文中查找
+	tests := []struct {
+		html, title, text string
+	}{
+		{`<body><header><h1>示例网站</h1><p>导航</p></header><h1>大阪</h1><p>商都</p></body>`, "大阪", "大阪\n商都"},
+		{`<body><header>页眉</header><article><header><h1>京都</h1></header><p>古都</p></article></body>`, "京都", "京都\n古都"},
+		{`<body><h1>示例网站</h1><main><p>古都</p></main></body>`, "", "古都"},
+	}
+	for _, tt := range tests {
+		got, err := ExtractHTML(strings.NewReader(tt.html))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Title != tt.title || got.Text != tt.text {
+			t.Errorf("ExtractHTML(%s) = %q, %q, want %q, %q", tt.html, got.Title, got.Text, tt.title, tt.text)
+		}
+	}
+}
+
+func TestHTMLSourcePath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wiser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "kyoto.html")
+	if err := ioutil.WriteFile(path, []byte(`<p>京都是日本的古都</p>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 以相对路径打开时记录绝对路径
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := NewHTMLSource(rel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := src.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Metadata[MetadataSource] != path {
+		t.Errorf("source = %q, want %q", doc.Metadata[MetadataSource], path)
+	}
+
+	// 从标准输入读取的页面没有标题时返回错误
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stdin := os.Stdin
+	os.Stdin = f
+	defer func() { os.Stdin = stdin }()
+	src, err = NewHTMLSource("-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.Next(); err == nil {
+		t.Errorf("Next of untitled page from stdin succeeded, want error")
+	}
+}
+
+func TestLoadHTMLDocuments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wiser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	files := map[string]string{
+		"tokyo.html":    testHTML,
+		"sub/osaka.htm": `<p>大阪是日本的城市</p>`,
+		"sub/notes.txt": "不是 HTML 文件",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	env := newTestEnv()
+	src, err := OpenDocumentSource(dir, SourceHTML, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if err := env.LoadDocuments(src, 100); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := env.Store.GetDocumentCount(); n != 2 {
+		t.Errorf("GetDocumentCount = %d, want 2", n)
+	}
+
+	id, _ := env.Store.GetDocumentID("东京 & 京都")
+	metadata, err := env.Store.GetDocumentMetadata(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata[MetadataSource] != filepath.Join(dir, "tokyo.html") || metadata[MetadataURL] != "https://example.com/tokyo" {
+		t.Errorf("metadata = %v", metadata)
+	}
+	// 没有标题的页面以文件路径作为标题
+	if id, _ := env.Store.GetDocumentID("sub/osaka"); id == 0 {
+		t.Errorf("page without title not indexed by file name")
+	}
+	for _, q := range []string{"首页", "脚本", "版权", "隐藏"} {
+		if ids := searchIDs(t, env, q); len(ids) != 0 {
+			t.Errorf("boilerplate %s indexed: %v", q, ids)
+		}
+	}
+	if ids := searchIDs(t, env, "首都"); len(ids) != 1 || ids[0] != id {
+		t.Errorf("search 首都 = %v, want [%d]", ids, id)
+	}
+}
+
+func TestHTMLSourceDuplicateTitles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wiser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	files := map[string]string{
+		"index.html":      `<title>示例网站</title><p>东京是日本的首都</p>`,
+		"kyoto/index.htm": `<title>示例网站</title><p>京都是日本的古都</p>`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 整个网站共用的标题只用于第一个页面，其他页面以相对路径作为标题
+	env := newTestEnv()
+	src, err := NewHTMLSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.LoadDocuments(src, 100); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := env.Store.GetDocumentCount(); n != 2 {
+		t.Errorf("GetDocumentCount = %d, want 2", n)
+	}
+	id, _ := env.Store.GetDocumentID("kyoto/index")
+	metadata, err := env.Store.GetDocumentMetadata(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == 0 || metadata[MetadataSource] != filepath.Join(dir, "kyoto", "index.htm") {
+		t.Errorf("page with duplicate title: id = %d, metadata = %v", id, metadata)
+	}
+}
@@ -1,48 +1,103 @@
 package logic
 
 import (
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/read-talk/wiser/dao"
+
+	"github.com/read-talk/wiser/util"
 )
 
 // 将内存上（小倒排索引中）的倒排列表与存储器上的倒排列表合并后存储到数据库中
 // env 存储着应用程序运行环境的结构体
 // p 含有倒排列表的倒排索引中的索引项
 func (env *WiserEnv) UpdatePostings(p *InvertedIndexValue) error {
+	deleted, err := env.deletedDocuments()
+	if err != nil {
+		return err
+	}
+	return env.updatePostings(p, deleted)
+}
 
+// 合并倒排列表，同时从存储器上的倒排列表中清除已删除的文档
+// deleted 已删除的文档编号的集合
+func (env *WiserEnv) updatePostings(p *InvertedIndexValue, deleted map[int]bool) error {
 	// 从数据库中取出作为合并源的倒排列表
-	oldPostings, oldPostingsLen, err := FetchPostings(p.TokenID)
+	oldPostings, _, err := env.FetchPostings(p.TokenID)
 	if err != nil {
 		fmt.Printf("cannot fetch old postings list of token(%d) for update.", p.TokenID)
 		return err
 	}
 	// 如果数据库中存在作为合并源的倒排列表
-	if oldPostings != nil {
+	if oldPostings.Len() > 0 {
+		oldPostings, _ = filterPostings(oldPostings, deleted)
 		// 就将该倒排列表和要合并进来的倒排列表合并在一起
 		p.PostingsList = MergePostings(oldPostings, p.PostingsList)
-		p.DocsCount += oldPostingsLen
+	}
+	p.DocsCount = p.PostingsList.Len()
+	return env.storePostings(p.TokenID, p.PostingsList)
+}
+
+// 将倒排列表转换成字节序列后存储到数据库中，同时更新文档数和词元的最大出现次数
+func (env *WiserEnv) storePostings(tokenID int, postings *PostingsList) error {
+	if postings.Len() == 0 {
+		return env.Store.UpdatePostings(tokenID, 0, 0, nil)
 	}
 	// 将内存上的倒排列表转换成了字节序列
-	buf, err := EncodePostings(p.PostingsList)
+	buf, err := env.EncodePostings(postings)
 	if err != nil {
 		return err
 	}
 	// 将转换后的字节序列存储到了数据库中
-	dao.UpdatePostings(p.TokenID, p.DocsCount, buf)
-	return nil
+	return env.Store.UpdatePostings(tokenID, postings.Len(), postings.MaxTermFrequency(), buf)
+}
+
+// 从倒排列表中去除指定的文档
+// 返回去除后的倒排列表，以及是否去除了文档。没有去除时返回原来的倒排列表
+func filterPostings(postings *PostingsList, excluded map[int]bool) (*PostingsList, bool) {
+	if len(excluded) == 0 {
+		return postings, false
+	}
+	var filtered *PostingsList
+	for i := 0; i < postings.Len(); i++ {
+		if !excluded[postings.DocumentIDs[i]] {
+			if filtered != nil {
+				filtered.Append(postings.DocumentIDs[i], postings.DocumentPositions(i)...)
+			}
+			continue
+		}
+		if filtered == nil {
+			// 第一次遇到要去除的文档时，复制之前的文档
+			filtered = NewPostingsList()
+			for j := 0; j < i; j++ {
+				filtered.Append(postings.DocumentIDs[j], postings.DocumentPositions(j)...)
+			}
+		}
+	}
+	if filtered == nil {
+		return postings, false
+	}
+	return filtered, true
 }
 
 // 从数据库中获取关联到指定词元上的倒排列表
 // env 存储着应用程序运行环境的结构体
 // token id 词元编号
 // 返回 postings 获取到的倒排列表
-func FetchPostings(tokenID int) (*PostingsList, int, error) {
-	docsCount, buf, err := dao.GetPostings(tokenID)
-	if buf == "" {
+func (env *WiserEnv) FetchPostings(tokenID int) (*PostingsList, int, error) {
+	err := env.syncSettings()
+	if err != nil {
+		return nil, 0, err
+	}
+	docsCount, buf, err := env.Store.GetPostings(tokenID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if buf == nil {
 		return nil, 0, nil
 	}
-	postings, err := DecodePostings(buf)
+	postings, err := env.DecodePostings(buf)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -50,47 +105,406 @@ func FetchPostings(tokenID int) (*PostingsList, int, error) {
 }
 
 // 将倒排列表转换成字节序列
-func EncodePostings(postings *PostingsList) (string, error) {
-	buf, err := json.Marshal(postings)
-	if err != nil {
-		return "", err
+// 使用的压缩方法由 env.Compress 决定
+func (env *WiserEnv) EncodePostings(postings *PostingsList) ([]byte, error) {
+	switch {
+	case env.Compress.CompressGolomb:
+		buf := []byte{postingsMarker, postingsGolombVersion}
+		return append(buf, encodePostingsGolomb(postings, env.IndexedCount)...), nil
+	case env.Compress.CompressVByte:
+		return encodePostingsVByte(postings), nil
+	default:
+		return encodePostingsNone(postings)
 	}
-	return string(buf), nil
 }
 
 // 对倒排列表进行还原或解码
-func DecodePostings(buf string) (*PostingsList, error) {
-	postings := &PostingsList{}
+// 根据开头的文件头区分 Golomb 编码、可变字节编码和 JSON，因此各种格式可以混在同一个索引中
+func (env *WiserEnv) DecodePostings(buf []byte) (*PostingsList, error) {
+	switch {
+	case isPostingsGolomb(buf):
+		return decodePostingsGolomb(buf[2:])
+	case isPostingsVByte(buf):
+		return decodePostingsVByte(buf)
+	default:
+		return decodePostingsNone(buf)
+	}
+}
+
+// 不压缩，直接将倒排列表转换成 JSON
+func encodePostingsNone(postings *PostingsList) ([]byte, error) {
+	return json.Marshal(postings)
+}
+
+// JSON 格式的倒排列表
+// 旧版本中倒排列表是链表，每个元素含有 DocumentID、Positions 和 Next，
+// 为了能读取旧的数据，同时保留了这两种结构的字段
+type jsonPostings struct {
+	DocumentIDs []int
+	Offsets     []int
+	Positions   []int
+
+	DocumentID int
+	Next       *jsonPostings
+}
 
-	err := json.Unmarshal([]byte(buf), postings)
+func decodePostingsNone(buf []byte) (*PostingsList, error) {
+	var v jsonPostings
+	err := json.Unmarshal(buf, &v)
 	if err != nil {
 		return nil, err
 	}
+	if v.DocumentIDs == nil && v.DocumentID == 0 {
+		return NewPostingsList(), nil
+	}
+	if v.DocumentIDs != nil {
+		postings := &PostingsList{DocumentIDs: v.DocumentIDs, Offsets: v.Offsets, Positions: v.Positions}
+		if len(postings.Offsets) != postings.Len()+1 {
+			return nil, errMalformedPostings
+		}
+		return postings, nil
+	}
+	postings := NewPostingsList()
+	for e := &v; e != nil; e = e.Next {
+		postings.Append(e.DocumentID, e.Positions...)
+	}
+	return postings, nil
+}
+
+// 二进制格式的文件头：标记字节和版本号
+// JSON 不会以 0x00 开头，所以可以通过标记字节区分 JSON 和二进制格式
+// 可变字节编码的版本号为 3，文档被分成了块，并带有用于跳过块的跳跃表。
+// Golomb 编码使用单独的版本号，文件头之后是 Golomb 编码的结果
+const (
+	postingsMarker        = 0x00
+	postingsVByteVersion  = 3
+	postingsGolombVersion = 0x80
+	postingsBlockSize     = 128 // 每个块中的文档数
+)
+
+var errMalformedPostings = errors.New("malformed postings")
+
+// 判断字节序列是否带有二进制格式的文件头
+func hasPostingsHeader(buf []byte) bool {
+	return len(buf) >= 2 && buf[0] == postingsMarker
+}
+
+// 判断字节序列是否为可变字节编码的二进制格式的倒排列表
+func isPostingsVByte(buf []byte) bool {
+	return hasPostingsHeader(buf) && buf[1] != postingsGolombVersion
+}
+
+// 判断字节序列是否为带有文件头的 Golomb 编码的倒排列表
+func isPostingsGolomb(buf []byte) bool {
+	return hasPostingsHeader(buf) && buf[1] == postingsGolombVersion
+}
+
+// 倒排列表中的一个块
+type postingsBlock struct {
+	lastDocumentID   int           // 块中最后一个文档编号
+	baseDocumentID   int           // 前一个块中最后一个文档编号
+	maxTermFrequency int           // 块中词元在单个文档中的最大出现次数
+	data             []byte        // 尚未解码的块
+	postings         *PostingsList // 块中的文档，解码后才有值
+	start, end       int           // 块中的文档在 postings 中的下标范围
+}
+
+// 对块进行解码
+func (b *postingsBlock) decode() error {
+	if b.postings != nil {
+		return nil
+	}
+	r := &uvarintReader{buf: b.data}
+	postings := NewPostingsList()
+	decodeDocumentsVByte(r, postings, b.baseDocumentID)
+	if r.err != nil {
+		return r.err
+	}
+	if postings.Len() == 0 {
+		return errMalformedPostings
+	}
+	b.postings = postings
+	b.start, b.end = 0, postings.Len()
+	b.data = nil
+	return nil
+}
+
+// 将已解码的倒排列表按 postingsBlockSize 分成块
+func splitPostingsBlocks(postings *PostingsList) []postingsBlock {
+	var blocks []postingsBlock
+	for start := 0; start < postings.Len(); start += postingsBlockSize {
+		end := start + postingsBlockSize
+		if end > postings.Len() {
+			end = postings.Len()
+		}
+		maxTermFrequency := 0
+		for i := start; i < end; i++ {
+			if n := postings.Offsets[i+1] - postings.Offsets[i]; n > maxTermFrequency {
+				maxTermFrequency = n
+			}
+		}
+		blocks = append(blocks, postingsBlock{
+			lastDocumentID:   postings.DocumentIDs[end-1],
+			maxTermFrequency: maxTermFrequency,
+			postings:         postings,
+			start:            start,
+			end:              end,
+		})
+	}
+	return blocks
+}
+
+// 将倒排列表转换成二进制格式
+// 格式为：文件头、文档数、块数、跳跃表、各个块。
+// 跳跃表中对于每个块依次记录块中最后一个文档编号与前一个块中最后一个文档编号的差、块的字节数，
+// 以及块中词元在单个文档中的最大出现次数。
+// 块中对于每个文档依次记录与前一个文档编号的差、位置信息的条数、与前一个位置的差。
+// 所有的数值都使用可变字节编码
+func encodePostingsVByte(postings *PostingsList) []byte {
+	docsCount := postings.Len()
+	var skips, blocks []byte
+	var block []byte
+	preDocumentID, blockBase, maxTermFrequency := 0, 0, 0
+	for i := 0; i < docsCount; i++ {
+		documentID := postings.DocumentIDs[i]
+		positions := postings.DocumentPositions(i)
+		if len(positions) > maxTermFrequency {
+			maxTermFrequency = len(positions)
+		}
+		block = appendUvarint(block, documentID-preDocumentID)
+		preDocumentID = documentID
+		block = appendUvarint(block, len(positions))
+		prePosition := 0
+		for _, pos := range positions {
+			block = appendUvarint(block, pos-prePosition)
+			prePosition = pos
+		}
+		if (i+1)%postingsBlockSize == 0 || i+1 == docsCount {
+			skips = appendUvarint(skips, documentID-blockBase)
+			skips = appendUvarint(skips, len(block))
+			skips = appendUvarint(skips, maxTermFrequency)
+			blocks = append(blocks, block...)
+			blockBase, maxTermFrequency = documentID, 0
+			block = block[:0]
+		}
+	}
+
+	buf := []byte{postingsMarker, postingsVByteVersion}
+	buf = appendUvarint(buf, docsCount)
+	buf = appendUvarint(buf, (docsCount+postingsBlockSize-1)/postingsBlockSize)
+	buf = append(buf, skips...)
+	return append(buf, blocks...)
+}
+
+// 读取二进制格式的倒排列表的跳跃表，返回尚未解码的各个块
+func decodePostingsBlocks(buf []byte) ([]postingsBlock, error) {
+	if buf[1] != postingsVByteVersion {
+		return nil, fmt.Errorf("unsupported postings version %d", buf[1])
+	}
+	r := &uvarintReader{buf: buf[2:]}
+	r.next() // 文档数
+	n := r.next()
+	if n > len(r.buf) {
+		return nil, errMalformedPostings
+	}
+	blocks := make([]postingsBlock, n)
+	lengths := make([]int, n)
+	base := 0
+	for i := range blocks {
+		blocks[i].baseDocumentID = base
+		blocks[i].lastDocumentID = base + r.next()
+		lengths[i] = r.next()
+		blocks[i].maxTermFrequency = r.next()
+		base = blocks[i].lastDocumentID
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	data := r.buf
+	for i := range blocks {
+		if lengths[i] > len(data) {
+			return nil, errMalformedPostings
+		}
+		blocks[i].data = data[:lengths[i]]
+		data = data[lengths[i]:]
+	}
+	return blocks, nil
+}
+
+// 对二进制格式的倒排列表进行解码
+func decodePostingsVByte(buf []byte) (*PostingsList, error) {
+	postings := NewPostingsList()
+	blocks, err := decodePostingsBlocks(buf)
+	if err != nil {
+		return nil, err
+	}
+	r := &uvarintReader{}
+	for i := range blocks {
+		r.buf = blocks[i].data
+		decodeDocumentsVByte(r, postings, blocks[i].baseDocumentID)
+	}
+	return postings, r.err
+}
+
+// 依次解码文档编号和位置信息直到 r 的末尾，并将它们追加到倒排列表中
+// pre document id 前一个文档编号
+func decodeDocumentsVByte(r *uvarintReader, postings *PostingsList, preDocumentID int) {
+	for r.err == nil && len(r.buf) > 0 {
+		documentID := preDocumentID + r.next()
+		preDocumentID = documentID
+		positionsCount := r.next()
+		if positionsCount > len(r.buf) {
+			r.err = errMalformedPostings
+			return
+		}
+		postings.Append(documentID)
+		prePosition := 0
+		for j := 0; j < positionsCount; j++ {
+			prePosition += r.next()
+			postings.AddPosition(prePosition)
+		}
+	}
+}
+
+// 以可变字节编码追加一个非负整数
+func appendUvarint(buf []byte, v int) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], uint64(v))
+	return append(buf, tmp[:n]...)
+}
+
+// 依次读取可变字节编码的整数，出错后都返回 0
+type uvarintReader struct {
+	buf []byte
+	err error
+}
+
+func (r *uvarintReader) next() int {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.err = errMalformedPostings
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return int(v)
+}
+
+// 使用 Golomb 编码压缩倒排列表
+// 文档编号和位置信息都先转换成与前一个值的差（间隔），再对间隔进行 Golomb 编码。
+// 文档编号间隔的参数根据文档数和建立了索引的文档总数计算，
+// 位置信息间隔的参数根据该倒排列表中位置信息的平均间隔计算，
+// 两个参数都记录在编码结果的开头，解码时不需要额外的信息。
+// indexed count 建立了索引的文档总数
+func encodePostingsGolomb(postings *PostingsList, indexedCount int) []byte {
+	docsCount := postings.Len()
+	positionsCount, positionsSpan := 0, 0
+	for i := 0; i < docsCount; i++ {
+		positions := postings.DocumentPositions(i)
+		positionsCount += len(positions)
+		if len(positions) > 0 {
+			positionsSpan += positions[len(positions)-1] + 1
+		}
+	}
+	// 文档编号不会超过文档总数以外的值，以两者中较大的一方作为文档编号的范围
+	if indexedCount < postings.LastDocumentID() {
+		indexedCount = postings.LastDocumentID()
+	}
+	w := &util.BitWriter{}
+	w.WriteGamma(uint64(docsCount) + 1)
+	if docsCount == 0 {
+		return w.Bytes()
+	}
+	docM := util.GolombParameter(float64(indexedCount) / float64(docsCount))
+	posM := uint64(1)
+	if positionsCount > 0 {
+		posM = util.GolombParameter(float64(positionsSpan) / float64(positionsCount))
+	}
+	w.WriteGamma(docM)
+	w.WriteGamma(posM)
+
+	preDocumentID := 0
+	for i := 0; i < docsCount; i++ {
+		documentID := postings.DocumentIDs[i]
+		w.WriteGolomb(uint64(documentID-preDocumentID-1), docM)
+		preDocumentID = documentID
+		positions := postings.DocumentPositions(i)
+		w.WriteGamma(uint64(len(positions)) + 1)
+		prePosition := -1
+		for _, pos := range positions {
+			w.WriteGolomb(uint64(pos-prePosition-1), posM)
+			prePosition = pos
+		}
+	}
+	return w.Bytes()
+}
+
+// 对使用 Golomb 编码压缩的倒排列表进行解码
+func decodePostingsGolomb(buf []byte) (*PostingsList, error) {
+	postings := NewPostingsList()
+	r := util.NewBitReader(buf)
+	docsCount, err := r.ReadGamma()
+	if err != nil {
+		return nil, err
+	}
+	docsCount--
+	if docsCount == 0 {
+		return postings, nil
+	}
+	docM, err := r.ReadGamma()
+	if err != nil {
+		return nil, err
+	}
+	posM, err := r.ReadGamma()
+	if err != nil {
+		return nil, err
+	}
+
+	preDocumentID := 0
+	for i := uint64(0); i < docsCount; i++ {
+		gap, err := r.ReadGolomb(docM)
+		if err != nil {
+			return nil, err
+		}
+		documentID := preDocumentID + int(gap) + 1
+		preDocumentID = documentID
+		postings.Append(documentID)
+
+		n, err := r.ReadGamma()
+		if err != nil {
+			return nil, err
+		}
+		prePosition := -1
+		for j := uint64(1); j < n; j++ {
+			gap, err := r.ReadGolomb(posM)
+			if err != nil {
+				return nil, err
+			}
+			prePosition += int(gap) + 1
+			postings.AddPosition(prePosition)
+		}
+	}
 	return postings, nil
 }
 
 // 获取将两个倒排列表合并后得到的倒排列表
+// 按文档编号的升序合并，文档编号相同时 pa 中的文档排在前面
 func MergePostings(pa, pb *PostingsList) *PostingsList {
-	var ret = &PostingsList{}
-	var p = &PostingsList{}
-	// 用pa和pb分别遍历base和to_be_added（参见函数merge_inverted_index）中的倒排列表中的元素，
-	// 将二者连接成按文档编号升序排列的链表
-	for pa != nil || pb != nil {
-		var e = &PostingsList{}
-		if pb == nil || (pa != nil && (pa.DocumentID <= pb.DocumentID)) {
-			e = pa
-			pa = pa.Next
-		} else if pa == nil || pa.DocumentID >= pb.DocumentID {
-			e = pb
-			pb = pb.Next
-		}
-		e.Next = nil
-		if ret == nil {
-			ret = e
+	ret := &PostingsList{
+		DocumentIDs: make([]int, 0, pa.Len()+pb.Len()),
+		Offsets:     make([]int, 1, pa.Len()+pb.Len()+1),
+	}
+	i, j := 0, 0
+	for i < pa.Len() || j < pb.Len() {
+		if j >= pb.Len() || (i < pa.Len() && pa.DocumentIDs[i] <= pb.DocumentIDs[j]) {
+			ret.Append(pa.DocumentIDs[i], pa.DocumentPositions(i)...)
+			i++
 		} else {
-			p.Next = e
+			ret.Append(pb.DocumentIDs[j], pb.DocumentPositions(j)...)
+			j++
 		}
-		p = e
 	}
 	return ret
 }
@@ -99,38 +513,38 @@ func MergePostings(pa, pb *PostingsList) *PostingsList {
 // base 合并后其中的元素会增多的倒排索引(合并目标)
 // to_be_added 合并后就被释放的倒排索引(合并源)
 func MergeInvertedIndex(base, toBeAdded *InvertedIndexHash) {
-	for _, p := range toBeAdded.HashMap {
-		var t = &InvertedIndexValue{}
+	for _, p := range toBeAdded.Items {
 		delete(toBeAdded.HashMap, p.TokenID)
 		t, ok := base.HashMap[p.TokenID]
 		if ok {
 			t.PostingsList = MergePostings(t.PostingsList, p.PostingsList)
 			t.DocsCount += p.DocsCount
+			t.PostingsCount += p.PostingsCount
 		} else {
 			base.HashMap[p.TokenID] = p
+			base.Items = append(base.Items, p)
 		}
 	}
+	toBeAdded.Items = toBeAdded.Items[:0]
 }
 
 // 打印倒排列表中的内容，用于调试
 // postings 待打印的倒排列表
 func dumpPostingsList(postings *PostingsList) {
-	for e := postings; e != nil; e = e.Next {
-		fmt.Printf(" doc_id: %d (", e.DocumentID)
-		if e.Positions != nil {
-			for _, p := range e.Positions {
-				fmt.Printf(" (位置: %d ) ", p)
-			}
+	for it := postings.Iterator(); !it.Done(); it.Next() {
+		fmt.Printf(" doc_id: %d (", it.DocumentID())
+		for _, p := range it.Positions() {
+			fmt.Printf(" (位置: %d ) ", p)
 		}
 		fmt.Printf(") ")
 	}
 }
 
 // 输出倒排索引的内容
-func DumpInvertedIndex(c *InvertedIndexHash) {
+func (env *WiserEnv) DumpInvertedIndex(c *InvertedIndexHash) {
 	for _, it := range c.HashMap {
 		if it.TokenID != 0 {
-			token, _ := dao.GetToken(it.TokenID)
+			token, _ := env.Store.GetToken(it.TokenID)
 			fmt.Printf("TOKEN %d.%s(%d):\n", it.TokenID, token, it.DocsCount)
 		} else {
 			fmt.Println("TOKEN NONE:")
@@ -0,0 +1,103 @@
+package logic
+
+import "sort"
+
+// 新建一个空的倒排列表
+func NewPostingsList() *PostingsList {
+	return &PostingsList{Offsets: []int{0}}
+}
+
+// 倒排列表中的文档数
+func (p *PostingsList) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.DocumentIDs)
+}
+
+// 第 i 个文档的位置信息
+func (p *PostingsList) DocumentPositions(i int) []int {
+	return p.Positions[p.Offsets[i]:p.Offsets[i+1]]
+}
+
+// 将文档添加到倒排列表的末尾
+// 文档编号必须不小于倒排列表中最后一个文档编号
+func (p *PostingsList) Append(documentID int, positions ...int) {
+	p.DocumentIDs = append(p.DocumentIDs, documentID)
+	p.Positions = append(p.Positions, positions...)
+	p.Offsets = append(p.Offsets, len(p.Positions))
+}
+
+// 为最后一个文档追加位置信息
+func (p *PostingsList) AddPosition(position int) {
+	p.Positions = append(p.Positions, position)
+	p.Offsets[len(p.Offsets)-1] = len(p.Positions)
+}
+
+// 最后一个文档编号，倒排列表为空时返回 0
+func (p *PostingsList) LastDocumentID() int {
+	if p.Len() == 0 {
+		return 0
+	}
+	return p.DocumentIDs[len(p.DocumentIDs)-1]
+}
+
+// 词元在单个文档中的最大出现次数
+func (p *PostingsList) MaxTermFrequency() int {
+	n := 0
+	for i := 0; i < p.Len(); i++ {
+		if tf := p.Offsets[i+1] - p.Offsets[i]; tf > n {
+			n = tf
+		}
+	}
+	return n
+}
+
+// 获取遍历倒排列表的迭代器
+func (p *PostingsList) Iterator() PostingsIterator {
+	return &postingsListIterator{postings: p}
+}
+
+// 倒排列表的迭代器
+// 调用方通过迭代器按文档编号的升序访问倒排列表，而不必关心倒排列表的存储结构
+type PostingsIterator interface {
+	// 是否已经遍历完所有的文档
+	Done() bool
+	// 当前的文档编号
+	DocumentID() int
+	// 当前文档中的位置信息
+	Positions() []int
+	// 移动到下一个文档
+	Next() error
+	// 移动到文档编号不小于 documentID 的第一个文档
+	SkipTo(documentID int) error
+}
+
+// 遍历内存上的倒排列表的迭代器
+type postingsListIterator struct {
+	postings *PostingsList
+	i        int // 当前文档的下标
+}
+
+func (it *postingsListIterator) Done() bool {
+	return it.i >= it.postings.Len()
+}
+
+func (it *postingsListIterator) DocumentID() int {
+	return it.postings.DocumentIDs[it.i]
+}
+
+func (it *postingsListIterator) Positions() []int {
+	return it.postings.DocumentPositions(it.i)
+}
+
+func (it *postingsListIterator) Next() error {
+	it.i++
+	return nil
+}
+
+func (it *postingsListIterator) SkipTo(documentID int) error {
+	ids := it.postings.DocumentIDs[it.i:]
+	it.i += sort.SearchInts(ids, documentID)
+	return nil
+}
@@ -0,0 +1,157 @@
+package logic
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 构造测试用的倒排列表
+func makePostings(docs map[int][]int, ids ...int) *PostingsList {
+	postings := NewPostingsList()
+	for _, id := range ids {
+		postings.Append(id, docs[id]...)
+	}
+	return postings
+}
+
+func TestEncodePostings(t *testing.T) {
+	docs := map[int][]int{
+		1:    {0, 5, 6, 100},
+		2:    {3},
+		9:    {0, 1, 2, 3, 4},
+		1000: {70000},
+	}
+	postings := makePostings(docs, 1, 2, 9, 1000)
+	for _, method := range []string{"none", "golomb", "vbyte"} {
+		env := newTestEnv()
+		env.Compress, _ = ParseCompressMethod(method)
+		env.IndexedCount = 1000
+		buf, err := env.EncodePostings(postings)
+		if err != nil {
+			t.Fatalf("%s: EncodePostings: %v", method, err)
+		}
+		got, err := env.DecodePostings(buf)
+		if err != nil {
+			t.Fatalf("%s: DecodePostings: %v", method, err)
+		}
+		if !reflect.DeepEqual(got, postings) {
+			t.Errorf("%s: round trip mismatch", method)
+		}
+	}
+}
+
+func TestCompressMethodSetting(t *testing.T) {
+	env := newTestEnv()
+	env.Compress = CompressMethod{CompressGolomb: true}
+	addDocuments(t, env, "甲", "东京都的天气", "乙", "京都的寺庙")
+	if v, _ := env.Store.GetSettings(SettingCompressMethod); v != "golomb" {
+		t.Fatalf("compress_method = %q, want golomb", v)
+	}
+
+	// 以其他压缩方法打开同一个索引时，仍按写入时的方法解码
+	reader := NewEnv(env.Store, 2048)
+	reader.Compress = CompressMethod{CompressNone: true}
+	reader.IndexedCount = 2
+	if results := search(t, reader, "京都"); len(results) != 2 {
+		t.Errorf("search found %d documents, want 2", len(results))
+	}
+	if !reader.Compress.CompressGolomb {
+		t.Errorf("compress method not loaded from settings")
+	}
+}
+
+func TestDecodePostingsMixedFormats(t *testing.T) {
+	docs := map[int][]int{3: {1, 2}, 7: {0}}
+	postings := makePostings(docs, 3, 7)
+	env := newTestEnv()
+	env.Compress = CompressMethod{CompressVByte: true}
+	// 旧版本中以链表的形式保存的 JSON
+	list := []byte(`{"DocumentID":3,"Positions":[1,2],"PositionsCount":2,"Next":{"DocumentID":7,"Positions":[0],"PositionsCount":1,"Next":null}}`)
+	// 带有文件头的 Golomb 编码，不需要 env.Compress 就可以解码
+	golomb := append([]byte{postingsMarker, postingsGolombVersion}, encodePostingsGolomb(postings, 10)...)
+	for _, buf := range [][]byte{encodePostingsVByte(postings), list, mustJSON(t, postings), golomb} {
+		got, err := env.DecodePostings(buf)
+		if err != nil {
+			t.Fatalf("DecodePostings(%q): %v", buf, err)
+		}
+		if !reflect.DeepEqual(got, postings) {
+			t.Errorf("DecodePostings(%q) mismatch", buf)
+		}
+	}
+}
+
+// 以旧版本的链表形式的 JSON 保存的倒排列表
+func legacyJSONPostings(postings *PostingsList) []byte {
+	var b strings.Builder
+	for i := 0; i < postings.Len(); i++ {
+		positions, _ := json.Marshal(postings.DocumentPositions(i))
+		fmt.Fprintf(&b, `{"DocumentID":%d,"Positions":%s,"PositionsCount":%d,"Next":`,
+			postings.DocumentIDs[i], positions, len(postings.DocumentPositions(i)))
+	}
+	b.WriteString("null" + strings.Repeat("}", postings.Len()))
+	return []byte(b.String())
+}
+
+func TestMigratePostings(t *testing.T) {
+	env := newTestEnv()
+	env.Compress = CompressMethod{CompressNone: true}
+	addDocuments(t, env, "甲", "东京都的天气", "乙", "京都的寺庙")
+	// 一部分倒排列表使用旧版本的格式
+	first, _ := env.Store.GetTokenIDs()
+	postings, count, _ := env.FetchPostings(first[0])
+	env.Store.UpdatePostings(first[0], count, postings.MaxTermFrequency(), legacyJSONPostings(postings))
+
+	n, err := env.MigratePostings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, _ := env.Store.GetTokenIDs()
+	if n != len(ids) {
+		t.Errorf("migrated %d postings, want %d", n, len(ids))
+	}
+	for _, id := range ids {
+		_, buf, _ := env.Store.GetPostings(id)
+		if !isPostingsVByte(buf) {
+			t.Errorf("postings of token %d not migrated", id)
+		}
+	}
+	if v, _ := env.Store.GetSettings(SettingCompressMethod); v != "vbyte" {
+		t.Errorf("compress_method = %q, want vbyte", v)
+	}
+	env.IndexedCount = 2
+	if results := search(t, env, "京都"); len(results) != 2 {
+		t.Errorf("search after migration found %d documents, want 2", len(results))
+	}
+	if n, _ := env.MigratePostings(); n != 0 {
+		t.Errorf("second migration rewrote %d postings", n)
+	}
+}
+
+func mustJSON(t *testing.T, postings *PostingsList) []byte {
+	buf, err := encodePostingsNone(postings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func TestPostingsListIterator(t *testing.T) {
+	docs := map[int][]int{2: {0, 4}, 5: {1}, 9: {2, 3}}
+	it := makePostings(docs, 2, 5, 9).Iterator()
+	if it.Done() || it.DocumentID() != 2 || !reflect.DeepEqual(it.Positions(), docs[2]) {
+		t.Fatalf("first document mismatch")
+	}
+	it.SkipTo(6)
+	if it.Done() || it.DocumentID() != 9 || !reflect.DeepEqual(it.Positions(), docs[9]) {
+		t.Fatalf("SkipTo(6) mismatch")
+	}
+	if it.Next(); !it.Done() {
+		t.Errorf("Next after last document = %d", it.DocumentID())
+	}
+	if it := NewPostingsList().Iterator(); !it.Done() {
+		t.Errorf("iterator of empty postings is not done")
+	}
+}
@@ -0,0 +1,248 @@
+package logic
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// 查询语法树中节点的种类
+type QueryOp int
+
+const (
+	QueryTerm   QueryOp = iota // 检索词，其中的词元都出现在文档中即可
+	QueryPhrase                // 用引号括起来的短语，其中的词元要在文档中连续出现
+	QueryAnd                   // 所有子节点都匹配
+	QueryOr                    // 任意一个子节点匹配
+	QueryNot                   // 子节点不匹配，只能作为 AND 的子节点出现
+)
+
+// 查询语法树的节点
+type QueryNode struct {
+	Op       QueryOp
+	Text     string       // 检索词或短语，只用于 QueryTerm 和 QueryPhrase
+	Children []*QueryNode // 子节点，只用于 QueryAnd、QueryOr 和 QueryNot
+}
+
+// 以便于阅读的形式输出语法树，例如 (AND 东京 (NOT "京都"))
+func (n *QueryNode) String() string {
+	switch n.Op {
+	case QueryTerm:
+		return n.Text
+	case QueryPhrase:
+		return `"` + n.Text + `"`
+	}
+	names := map[QueryOp]string{QueryAnd: "AND", QueryOr: "OR", QueryNot: "NOT"}
+	parts := []string{names[n.Op]}
+	for _, c := range n.Children {
+		parts = append(parts, c.String())
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+// 查询中的记号
+type queryToken struct {
+	kind queryTokenKind
+	text string
+}
+
+type queryTokenKind int
+
+const (
+	queryTokenEOF queryTokenKind = iota
+	queryTokenWord
+	queryTokenPhrase
+	queryTokenAnd
+	queryTokenOr
+	queryTokenNot
+	queryTokenLParen
+	queryTokenRParen
+)
+
+// 解析查询字符串，生成查询语法树
+// 支持以下语法，优先级从高到低为 NOT、AND、OR：
+//
+//	东京 京都        以空白分隔的检索词，相当于 AND
+//	东京 AND 京都    两者都出现
+//	东京 OR 京都     任意一个出现
+//	NOT 京都、-京都  不出现
+//	"东京都"         短语
+//	(东京 OR 大阪) -京都  用括号改变优先级
+func ParseQuery(q string) (*QueryNode, error) {
+	tokens, err := lexQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	if p.peek().kind == queryTokenEOF {
+		return nil, fmt.Errorf("empty query")
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != queryTokenEOF {
+		return nil, fmt.Errorf("unexpected %q in query", t.text)
+	}
+	return node, nil
+}
+
+// 将查询字符串分割为记号
+func lexQuery(q string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(q)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{queryTokenLParen, "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{queryTokenRParen, ")"})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated phrase in query")
+			}
+			tokens = append(tokens, queryToken{queryTokenPhrase, string(runes[i+1 : end])})
+			i = end + 1
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			// 紧贴在检索词前面的减号表示 NOT
+			tokens = append(tokens, queryToken{queryTokenNot, "-"})
+			i++
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) &&
+				runes[end] != '(' && runes[end] != ')' && runes[end] != '"' {
+				end++
+			}
+			word := string(runes[i:end])
+			kind := queryTokenWord
+			switch word {
+			case "AND":
+				kind = queryTokenAnd
+			case "OR":
+				kind = queryTokenOr
+			case "NOT":
+				kind = queryTokenNot
+			}
+			tokens = append(tokens, queryToken{kind, word})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// 递归下降的查询解析器
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() queryToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return queryToken{kind: queryTokenEOF}
+}
+
+func (p *queryParser) next() queryToken {
+	t := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return t
+}
+
+// or := and ("OR" and)*
+func (p *queryParser) parseOr() (*QueryNode, error) {
+	node, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == queryTokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		node = joinQueryNodes(QueryOr, node, right)
+	}
+	return node, nil
+}
+
+// and := unary (["AND"] unary)*
+func (p *queryParser) parseAnd() (*QueryNode, error) {
+	node, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek().kind {
+		case queryTokenAnd:
+			p.next()
+		case queryTokenWord, queryTokenPhrase, queryTokenNot, queryTokenLParen:
+			// 省略了 AND
+		default:
+			return node, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		node = joinQueryNodes(QueryAnd, node, right)
+	}
+}
+
+// unary := ("NOT" | "-") unary | "(" or ")" | word | phrase
+func (p *queryParser) parseUnary() (*QueryNode, error) {
+	t := p.next()
+	switch t.kind {
+	case queryTokenNot:
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if child.Op == QueryNot {
+			// 双重否定
+			return child.Children[0], nil
+		}
+		return &QueryNode{Op: QueryNot, Children: []*QueryNode{child}}, nil
+	case queryTokenLParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != queryTokenRParen {
+			return nil, fmt.Errorf("missing ')' in query")
+		}
+		return node, nil
+	case queryTokenWord:
+		return &QueryNode{Op: QueryTerm, Text: t.text}, nil
+	case queryTokenPhrase:
+		return &QueryNode{Op: QueryPhrase, Text: t.text}, nil
+	case queryTokenEOF:
+		return nil, fmt.Errorf("unexpected end of query")
+	default:
+		return nil, fmt.Errorf("unexpected %q in query", t.text)
+	}
+}
+
+// 用 op 连接两个节点，同种节点的子节点会被展开
+func joinQueryNodes(op QueryOp, left, right *QueryNode) *QueryNode {
+	node := &QueryNode{Op: op}
+	for _, n := range []*QueryNode{left, right} {
+		if n.Op == op {
+			node.Children = append(node.Children, n.Children...)
+		} else {
+			node.Children = append(node.Children, n)
+		}
+	}
+	return node
+}
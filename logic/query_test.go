@@ -0,0 +1,150 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"东京", "东京"},
+		{"东京 京都", "(AND 东京 京都)"},
+		{"东京 AND 京都", "(AND 东京 京都)"},
+		{"东京 OR 京都 大阪", "(OR 东京 (AND 京都 大阪))"},
+		{"东京 -京都", "(AND 东京 (NOT 京都))"},
+		{"东京 NOT NOT 京都", "(AND 东京 京都)"},
+		{`"东京都" OR (京都 大阪)`, `(OR "东京都" (AND 京都 大阪))`},
+		{"(东京 OR 大阪) -(京都 OR 奈良)", "(AND (OR 东京 大阪) (NOT (OR 京都 奈良)))"},
+		{"a-b", "a-b"},
+	}
+	for _, tt := range tests {
+		node, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", tt.query, err)
+			continue
+		}
+		if got := node.String(); got != tt.want {
+			t.Errorf("ParseQuery(%q) = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+
+	for _, q := range []string{"", "  ", `"东京`, "(东京", "东京)", "东京 OR", "AND 东京"} {
+		if node, err := ParseQuery(q); err == nil {
+			t.Errorf("ParseQuery(%q) = %s, want error", q, node)
+		}
+	}
+}
+
+func TestBooleanSearch(t *testing.T) {
+	env := newTestEnv()
+	addDocuments(t, env,
+		"甲", "东京都的天气",
+		"乙", "京都的寺庙",
+		"丙", "东京的夜景",
+		"丁", "大阪的美食",
+		"戊", "京都东京")
+
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"东京 京都", []int{1, 5}},
+		{"东京 AND 京都", []int{1, 5}},
+		{"东京 OR 大阪", []int{1, 3, 4, 5}},
+		{"东京 -京都", []int{3}},
+		{"京都 NOT 东京", []int{2}},
+		{`"东京都"`, []int{1}},
+		{`"京都东京" OR 大阪`, []int{4, 5}},
+		{"(东京 OR 大阪) -(京都 OR 夜景)", []int{4}},
+		{"寺庙 OR 奈良", []int{2}},
+		{"奈良", nil},
+	}
+	for _, tt := range tests {
+		got := searchIDs(t, env, tt.query)
+		sort.Ints(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	for _, q := range []string{"-东京", "NOT 东京 OR 京都", "东", "东 OR 京"} {
+		query, err := ParseQuery(q)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q): %v", q, err)
+		}
+		results := newTopKResults(0, nil)
+		if err := env.searchDocs(context.Background(), query, env.Scorer, false, results); err == nil {
+			t.Errorf("searchDocs(%q) succeeded, want error", q)
+		}
+	}
+}
+
+func TestUntokenizableTerm(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"东京 东", []int{1, 3, 5}},
+		{"东 东京 。", []int{1, 3, 5}},
+		{"东京 -东", []int{1, 3, 5}},
+		{"东京 OR 东", []int{1, 3, 5}},
+		{"(东京 东) OR 大阪", []int{1, 3, 4, 5}},
+		{"(东 。) OR 大阪", []int{4}},
+		{"(东 OR 。) 大阪", []int{4}},
+	}
+	// 无法提取出词元的检索词在任何位置、任何分析器下都从其所在的分支中去除
+	for _, name := range []string{AnalyzerNgram2, AnalyzerMixed} {
+		env := newTestEnv()
+		env.Analyzer, _ = NewAnalyzer(name, 2, "")
+		addDocuments(t, env,
+			"甲", "东京都的天气",
+			"乙", "京都的寺庙",
+			"丙", "东京的夜景",
+			"丁", "大阪的美食",
+			"戊", "京都东京")
+		for _, prune := range []bool{false, true} {
+			for _, tt := range tests {
+				query, err := ParseQuery(tt.query)
+				if err != nil {
+					t.Fatalf("ParseQuery(%q): %v", tt.query, err)
+				}
+				results := newTopKResults(10, nil)
+				if err := env.searchDocs(context.Background(), query, env.Scorer, prune, results); err != nil {
+					t.Errorf("%s: searchDocs(%q, %v): %v", name, tt.query, prune, err)
+					continue
+				}
+				var got []int
+				for _, r := range results.sorted() {
+					got = append(got, r.DocumentID)
+				}
+				sort.Ints(got)
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%s: searchDocs(%q, %v) = %v, want %v", name, tt.query, prune, got, tt.want)
+				}
+			}
+			// 整个查询都被去除时返回错误
+			for _, q := range []string{"东", "东 。", "东 OR 。", "东 -东京"} {
+				query, _ := ParseQuery(q)
+				results := newTopKResults(10, nil)
+				if err := env.searchDocs(context.Background(), query, env.Scorer, prune, results); !errors.Is(err, errTooShortQuery) {
+					t.Errorf("%s: searchDocs(%q, %v) = %v, want errTooShortQuery", name, q, prune, err)
+				}
+			}
+		}
+	}
+}
+
+func TestBooleanSearchScore(t *testing.T) {
+	env := newTestEnv()
+	addDocuments(t, env, "甲", "东京", "乙", "东京和大阪")
+	// 同时匹配 OR 的多个子节点的文档得分更高
+	if got := searchIDs(t, env, "东京 OR 大阪"); !reflect.DeepEqual(got, []int{2, 1}) {
+		t.Errorf("search = %v, want [2 1]", got)
+	}
+}
@@ -0,0 +1,86 @@
+package logic
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// 检索结果的集合，只保留按得分排在前面的 k 个结果
+// 结果按得分的降序排列，得分相同时按文档编号的升序排列，
+// 这样每个结果都有确定的位置，可以从某个结果之后继续获取（search after）。
+type topKResults struct {
+	k     int             // 保留的结果数，为 0 时保留所有结果
+	after *SearchResult   // 只保留排在该结果之后的结果，为 nil 时不限制
+	items []*SearchResult // 以排在最后的结果为根的最小堆
+	total int             // 添加过的结果总数，包括被 after 排除的结果
+	// 检索时是否跳过了可能匹配的文档，跳过时 total 只是匹配的文档数的下限
+	pruned bool
+}
+
+// 新建检索结果的集合
+// k 保留的结果数，为 0 时保留所有结果
+// after 只保留排在该结果之后的结果，可以为 nil
+func newTopKResults(k int, after *SearchResult) *topKResults {
+	return &topKResults{k: k, after: after}
+}
+
+// 结果 a 是否排在结果 b 之前
+func resultBefore(a, b *SearchResult) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return a.DocumentID < b.DocumentID
+}
+
+func (r *topKResults) Len() int { return len(r.items) }
+
+func (r *topKResults) Less(i, j int) bool { return resultBefore(r.items[j], r.items[i]) }
+
+func (r *topKResults) Swap(i, j int) { r.items[i], r.items[j] = r.items[j], r.items[i] }
+
+func (r *topKResults) Push(x interface{}) { r.items = append(r.items, x.(*SearchResult)) }
+
+func (r *topKResults) Pop() interface{} {
+	n := len(r.items)
+	x := r.items[n-1]
+	r.items = r.items[:n-1]
+	return x
+}
+
+// 将文档添加到检索结果中
+// 已保留 k 个结果时，只有排在堆顶之前的结果才会替换堆顶
+func (r *topKResults) add(documentID int, score float64) {
+	r.total++
+	result := SearchResult{DocumentID: documentID, Score: score}
+	if r.after != nil && !resultBefore(r.after, &result) {
+		return
+	}
+	if r.k == 0 || len(r.items) < r.k {
+		heap.Push(r, &result)
+		return
+	}
+	// 替换堆顶时复用其内存
+	if resultBefore(&result, r.items[0]) {
+		*r.items[0] = result
+		heap.Fix(r, 0)
+	}
+}
+
+// 已保留 k 个结果时，返回其中的最低得分
+// 之后的文档得分不超过该得分时不可能进入检索结果
+func (r *topKResults) threshold() (float64, bool) {
+	if r.k == 0 || len(r.items) < r.k {
+		return 0, false
+	}
+	return r.items[0].Score, true
+}
+
+// 返回按顺序排列的检索结果
+func (r *topKResults) sorted() []*SearchResult {
+	items := make([]*SearchResult, len(r.items))
+	copy(items, r.items)
+	sort.Slice(items, func(i, j int) bool {
+		return resultBefore(items[i], items[j])
+	})
+	return items
+}
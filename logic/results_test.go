@@ -0,0 +1,92 @@
+package logic
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestTopKResults(t *testing.T) {
+	scores := []float64{3, 1, 4, 1, 5, 9, 2, 6}
+	add := func(r *topKResults) []int {
+		for i, s := range scores {
+			r.add(i+1, s)
+		}
+		var ids []int
+		for _, item := range r.sorted() {
+			ids = append(ids, item.DocumentID)
+		}
+		return ids
+	}
+	if got, want := add(newTopKResults(0, nil)), []int{6, 8, 5, 3, 1, 7, 2, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("all = %v, want %v", got, want)
+	}
+	r := newTopKResults(3, nil)
+	if got, want := add(r), []int{6, 8, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("top 3 = %v, want %v", got, want)
+	}
+	if len(r.items) != 3 || r.total != len(scores) {
+		t.Errorf("len(items) = %d, total = %d", len(r.items), r.total)
+	}
+	// 得分相同时按文档编号排列
+	after := &SearchResult{DocumentID: 2, Score: 1}
+	if got, want := add(newTopKResults(2, after)), []int{4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after = %v, want %v", got, want)
+	}
+}
+
+func TestSearchPagination(t *testing.T) {
+	env := newTestEnv()
+	var docs []string
+	for i := 0; i < 25; i++ {
+		body := "东京"
+		for j := 0; j < i%7; j++ {
+			body += "和东京"
+		}
+		docs = append(docs, string(rune('a'+i)), body)
+	}
+	addDocuments(t, env, docs...)
+
+	all, stats, err := env.Search(context.Background(), "东京", nil)
+	if err != nil || stats.TotalHits != 25 || len(all) != 25 {
+		t.Fatalf("Search = %d hits, %+v, %v", len(all), stats, err)
+	}
+
+	// limit/offset
+	var paged []Hit
+	for offset := 0; offset < 30; offset += 10 {
+		hits, stats, err := env.Search(context.Background(), "东京", &SearchOptions{Limit: 10, Offset: offset})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.TotalHits != 25 {
+			t.Errorf("TotalHits = %d, want 25", stats.TotalHits)
+		}
+		paged = append(paged, hits...)
+	}
+	if !reflect.DeepEqual(paged, all) {
+		t.Errorf("limit/offset pages differ from full results")
+	}
+
+	// search after
+	var after []Hit
+	opts := &SearchOptions{Limit: 7}
+	for {
+		hits, _, err := env.Search(context.Background(), "东京", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hits) == 0 {
+			break
+		}
+		after = append(after, hits...)
+		opts.SearchAfter = &hits[len(hits)-1]
+	}
+	if !reflect.DeepEqual(after, all) {
+		t.Errorf("search after pages differ from full results")
+	}
+
+	if _, _, err := env.Search(context.Background(), "东京", &SearchOptions{Limit: -1}); err == nil {
+		t.Error("Search with negative limit succeeded")
+	}
+}
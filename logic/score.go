@@ -0,0 +1,167 @@
+package logic
+
+import (
+	"math"
+	"strconv"
+)
+
+// 计算得分时用到的整个索引的统计信息
+type CollectionStats struct {
+	IndexedCount          int     // 建立了索引的文档总数
+	AverageDocumentLength float64 // 文档的平均长度（词元数）
+}
+
+// 计算文档与查询的匹配度
+// 文档的得分是查询中各词元的得分之和
+type Scorer interface {
+	// 计算一个词元对文档得分的贡献
+	// stats 整个索引的统计信息
+	// tf 词元在文档中的出现次数
+	// docs count 出现过该词元的文档数
+	// document length 文档的长度（词元数）
+	Score(stats *CollectionStats, tf, docsCount, documentLength int) float64
+	// 计算词元出现次数不超过 maxTF 的所有文档中，该词元得分的上限
+	// 用于在检索时跳过不可能进入检索结果的文档，maxTF 为 0 时表示次数未知，返回正无穷大
+	MaxScore(stats *CollectionStats, maxTF, docsCount int) float64
+	// 计算得分时是否需要文档的长度
+	UsesDocumentLength() bool
+}
+
+// 使用 TF-IDF 计算得分
+type TfIdfScorer struct{}
+
+func (TfIdfScorer) Score(stats *CollectionStats, tf, docsCount, documentLength int) float64 {
+	return float64(tf) * idf(stats.IndexedCount, docsCount)
+}
+
+func (s TfIdfScorer) MaxScore(stats *CollectionStats, maxTF, docsCount int) float64 {
+	if maxTF == 0 {
+		return math.Inf(1)
+	}
+	return s.Score(stats, maxTF, docsCount, 0)
+}
+
+func (TfIdfScorer) UsesDocumentLength() bool {
+	return false
+}
+
+// 计算逆文档频率
+// 加 1 是为了让出现在所有文档中的词元也能为得分做出贡献
+func idf(indexedCount, docsCount int) float64 {
+	if docsCount <= 0 {
+		return 0
+	}
+	if indexedCount < docsCount {
+		indexedCount = docsCount
+	}
+	return math.Log(float64(indexedCount)/float64(docsCount)) + 1
+}
+
+// BM25 参数的默认值
+const (
+	DefaultBM25K1 = 1.2
+	DefaultBM25B  = 0.75
+)
+
+// 使用 Okapi BM25 计算得分
+type BM25Scorer struct {
+	K1 float64 // 词频的饱和程度，越大则词频对得分的影响越大
+	B  float64 // 文档长度归一化的程度，取值范围为 0 到 1
+}
+
+// 使用默认参数新建 BM25
+func NewBM25Scorer() *BM25Scorer {
+	return &BM25Scorer{K1: DefaultBM25K1, B: DefaultBM25B}
+}
+
+func (s *BM25Scorer) Score(stats *CollectionStats, tf, docsCount, documentLength int) float64 {
+	if tf == 0 || docsCount <= 0 {
+		return 0
+	}
+	n := float64(stats.IndexedCount)
+	df := float64(docsCount)
+	if n < df {
+		n = df
+	}
+	idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+	norm := 1.0
+	if stats.AverageDocumentLength > 0 {
+		norm = 1 - s.B + s.B*float64(documentLength)/stats.AverageDocumentLength
+	}
+	return idf * float64(tf) * (s.K1 + 1) / (float64(tf) + s.K1*norm)
+}
+
+// 得分随词频增大而增大，随文档长度增大而减小，因此取文档长度为 0 时的得分作为上限
+func (s *BM25Scorer) MaxScore(stats *CollectionStats, maxTF, docsCount int) float64 {
+	if maxTF == 0 {
+		return math.Inf(1)
+	}
+	return s.Score(stats, maxTF, docsCount, 0)
+}
+
+func (s *BM25Scorer) UsesDocumentLength() bool {
+	return true
+}
+
+// 计算得分的方法和整个索引的统计信息，在一次检索中共用
+type scoreContext struct {
+	scorer Scorer
+	stats  *CollectionStats
+}
+
+// 计算得分的方法，没有指定时使用 TF-IDF
+func (sc *scoreContext) scorerOrDefault() Scorer {
+	if sc.scorer == nil {
+		return TfIdfScorer{}
+	}
+	return sc.scorer
+}
+
+// 获取计算得分时用到的整个索引的统计信息
+func (env *WiserEnv) collectionStats() (*CollectionStats, error) {
+	count, err := env.Store.GetDocumentCount()
+	if err != nil {
+		return nil, err
+	}
+	stats := &CollectionStats{IndexedCount: count}
+	value, err := env.Store.GetSettings(SettingTotalTokenCount)
+	if err != nil {
+		return nil, err
+	}
+	if value != "" && count > 0 {
+		total, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		stats.AverageDocumentLength = float64(total) / float64(count)
+	}
+	return stats, nil
+}
+
+// 计算文档的得分
+// sc 计算得分的方法和整个索引的统计信息
+// query tokens 查询
+// doc cursors 用于文档检索的游标的集合，都指向要计算得分的文档
+// phrase count 短语在文档中出现的次数，不为 0 时将其作为各词元的词频
+// 返回得分
+func (env *WiserEnv) calcScore(sc *scoreContext, queryTokens *QueryTokenHash, docCursors []*DocSearchCursor,
+	phraseCount int) (float64, error) {
+	scorer := sc.scorerOrDefault()
+	documentLength := 0
+	if scorer.UsesDocumentLength() {
+		var err error
+		documentLength, err = env.Store.GetDocumentLength(docCursors[0].DocumentID())
+		if err != nil {
+			return 0, err
+		}
+	}
+	var score float64
+	for i, qt := range queryTokens.Items {
+		tf := len(docCursors[i].Positions())
+		if phraseCount > 0 {
+			tf = phraseCount
+		}
+		score += scorer.Score(sc.stats, tf, qt.DocsCount, documentLength)
+	}
+	return score, nil
+}
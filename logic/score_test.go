@@ -0,0 +1,77 @@
+package logic
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestDocumentLength(t *testing.T) {
+	env := newTestEnv()
+	addDocuments(t, env, "a", "东京都", "b", "京都府京都市")
+	for title, want := range map[string]int{"a": 2, "b": 5} {
+		id, _ := env.Store.GetDocumentID(title)
+		n, err := env.Store.GetDocumentLength(id)
+		if err != nil || n != want {
+			t.Errorf("GetDocumentLength(%s) = %d, %v; want %d", title, n, err, want)
+		}
+	}
+	// 更新文档后，文档总长度中减去原来的长度
+	addDocuments(t, env, "b", "京都")
+	value, _ := env.Store.GetSettings(SettingTotalTokenCount)
+	if value != "3" {
+		t.Errorf("%s = %q, want 3", SettingTotalTokenCount, value)
+	}
+	env.IndexedCount, _ = env.Store.GetDocumentCount()
+	stats, err := env.collectionStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.AverageDocumentLength != 1.5 {
+		t.Errorf("AverageDocumentLength = %v, want 1.5", stats.AverageDocumentLength)
+	}
+}
+
+func TestTfIdfScorer(t *testing.T) {
+	stats := &CollectionStats{IndexedCount: 10}
+	s := TfIdfScorer{}
+	if got, want := s.Score(stats, 2, 5, 0), 2*(math.Log(2)+1); math.Abs(got-want) > 1e-9 {
+		t.Errorf("Score = %v, want %v", got, want)
+	}
+	// 出现在所有文档中的词元也有得分
+	if got := s.Score(stats, 1, 10, 0); got != 1 {
+		t.Errorf("Score = %v, want 1", got)
+	}
+}
+
+func TestBM25Scorer(t *testing.T) {
+	stats := &CollectionStats{IndexedCount: 10, AverageDocumentLength: 100}
+	s := NewBM25Scorer()
+	short := s.Score(stats, 3, 2, 50)
+	long := s.Score(stats, 3, 2, 200)
+	if short <= long {
+		t.Errorf("short document score %v <= long document score %v", short, long)
+	}
+	// 词频的影响是饱和的
+	if s.Score(stats, 100, 2, 100) >= s.Score(stats, 1, 2, 100)*(s.K1+1) {
+		t.Error("term frequency is not saturated")
+	}
+	// b 为 0 时不考虑文档长度
+	s.B = 0
+	if s.Score(stats, 3, 2, 50) != s.Score(stats, 3, 2, 200) {
+		t.Error("document length affects score with b = 0")
+	}
+}
+
+func TestSearchBM25(t *testing.T) {
+	env := newTestEnv()
+	env.Scorer = NewBM25Scorer()
+	addDocuments(t, env,
+		"short", "东京",
+		"long", "东京和京都和大阪和名古屋和横滨",
+	)
+	// 词频相同时，较短的文档得分更高
+	if got, want := searchIDs(t, env, "东京"), []int{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("search = %v, want %v", got, want)
+	}
+}
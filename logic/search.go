@@ -1,21 +1,28 @@
 package logic
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"github.com/read-talk/wiser/dao"
+	"math"
 	"sort"
+	"time"
 )
 
 // 将类型 InvertedIndexHash InvertedIndexValue 也用于检索
 type QueryTokenHash = InvertedIndexHash
 type QueryTokenValue = InvertedIndexValue
-type TokenPositionsList = PostingsList
 
+// 用于文档检索的游标，遍历关联到某个词元上的倒排列表
 type DocSearchCursor struct {
-	Documents *TokenPositionsList // 文档编号的序列
-	Current   *TokenPositionsList // 当前的文档编号
+	blocks []postingsBlock // 文档编号的序列被分成的块
+	block  int             // 当前文档所在的块
+	i      int             // 当前文档在块的倒排列表中的下标
+	linear bool            // SkipTo 时不跳过块，逐个文档移动
 }
 
+var _ PostingsIterator = (*DocSearchCursor)(nil)
+
 type PhraseSearchCursor struct {
 	Positions []int // 位置信息
 	Base      int   // 词元在查询中的位置
@@ -23,169 +30,816 @@ type PhraseSearchCursor struct {
 }
 
 type SearchResult struct {
-	documentID int     // 检索出的文档编号
+	DocumentID int     // 检索出的文档编号
 	Score      float64 // 检索得分
 }
 
-// 检索结果的结构体转化为哈希表
-type SearchResultHash struct {
-	HashMap map[int]*SearchResult
-	Item    []*SearchResult
+// 打开关联到指定词元上的倒排列表的游标
+// 二进制格式的倒排列表只在游标到达某个块时才对该块进行解码
+// 返回指向第一个文档的游标，倒排列表为空时返回 nil
+func (env *WiserEnv) openDocSearchCursor(tokenID int) (*DocSearchCursor, error) {
+	err := env.syncSettings()
+	if err != nil {
+		return nil, err
+	}
+	_, buf, err := env.Store.GetPostings(tokenID)
+	if err != nil || buf == nil {
+		return nil, err
+	}
+	var blocks []postingsBlock
+	if isPostingsVByte(buf) {
+		blocks, err = decodePostingsBlocks(buf)
+	} else {
+		var postings *PostingsList
+		postings, err = env.DecodePostings(buf)
+		blocks = splitPostingsBlocks(postings)
+	}
+	if err != nil || len(blocks) == 0 {
+		return nil, err
+	}
+	cursor := &DocSearchCursor{blocks: blocks, linear: env.disableSkip}
+	err = cursor.moveToBlock(0)
+	if err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+// 是否已经遍历完所有的文档
+func (c *DocSearchCursor) Done() bool {
+	return c.block >= len(c.blocks)
+}
+
+// 当前的文档编号
+func (c *DocSearchCursor) DocumentID() int {
+	return c.blocks[c.block].postings.DocumentIDs[c.i]
+}
+
+// 当前文档中的位置信息
+func (c *DocSearchCursor) Positions() []int {
+	return c.blocks[c.block].postings.DocumentPositions(c.i)
+}
+
+// 将游标移动到下一个文档
+func (c *DocSearchCursor) Next() error {
+	if c.Done() {
+		return nil
+	}
+	c.i++
+	if c.i < c.blocks[c.block].end {
+		return nil
+	}
+	// 已经到达块的末尾，移动到下一个块
+	return c.moveToBlock(c.block + 1)
+}
+
+// 将游标移动到文档编号不小于 documentID 的第一个文档
+// 借助每个块中最后一个文档编号，跳过不可能包含该文档的块
+func (c *DocSearchCursor) SkipTo(documentID int) error {
+	if c.Done() || c.DocumentID() >= documentID {
+		return nil
+	}
+	if c.linear {
+		for !c.Done() && c.DocumentID() < documentID {
+			err := c.Next()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if c.blocks[c.block].lastDocumentID < documentID {
+		rest := c.blocks[c.block+1:]
+		i := sort.Search(len(rest), func(i int) bool {
+			return rest[i].lastDocumentID >= documentID
+		})
+		err := c.moveToBlock(c.block + 1 + i)
+		if err != nil || c.Done() {
+			return err
+		}
+	}
+	// 目标文档就在当前块中
+	b := &c.blocks[c.block]
+	c.i += sort.SearchInts(b.postings.DocumentIDs[c.i:b.end], documentID)
+	return nil
 }
 
-// 进行全文检索 query 查询
-func (env *WiserEnv) Search(q string) {
-	// 1. 判断查询字符串的长度是否大于 N-gram 中的 N 的取值
-	var result = &SearchResultHash{}
-	if len(q) < env.TokenLen {
-		fmt.Println("too short query.")
-		return
-	} else { // 2. 如果长度大于N，就将词元从查询字符串中提取出来
-		queryTokens, _ := env.splitQueryToTokens(q)
-		// 3. 以刚刚提取出来的词元作为参数，开始进行检索处理
-		env.searchDocs(queryTokens, result)
+// 获取文档编号不小于 documentID 的第一个文档所在的块，不移动游标
+// 返回块中词元的最大出现次数和块中最后一个文档编号，没有这样的块时返回 false
+func (c *DocSearchCursor) blockMax(documentID int) (int, int, bool) {
+	if c.Done() {
+		return 0, 0, false
+	}
+	i := c.block
+	if c.blocks[i].lastDocumentID < documentID {
+		rest := c.blocks[i+1:]
+		i += 1 + sort.Search(len(rest), func(i int) bool {
+			return rest[i].lastDocumentID >= documentID
+		})
+		if i >= len(c.blocks) {
+			return 0, 0, false
+		}
 	}
-	// 4. 打印检索结果
-	printSearchResults(result)
+	return c.blocks[i].maxTermFrequency, c.blocks[i].lastDocumentID, true
+}
+
+// 将游标移动到指定块的第一个文档
+func (c *DocSearchCursor) moveToBlock(i int) error {
+	c.block = i
+	if c.Done() {
+		return nil
+	}
+	err := c.blocks[i].decode()
+	if err != nil {
+		return err
+	}
+	c.i = c.blocks[i].start
+	return nil
+}
+
+// 检索选项
+type SearchOptions struct {
+	Scorer      Scorer // 计算得分的方法，为 nil 时使用运行环境中设置的方法
+	Limit       int    // 返回的结果数，为 0 时返回所有结果
+	Offset      int    // 跳过排在前面的结果数
+	SearchAfter *Hit   // 只返回排在该结果之后的结果，通常是上一页的最后一个结果
+	// 是否统计准确的匹配文档数
+	// 为 false 时，OR 查询会跳过不可能进入检索结果的文档，匹配的文档数可能偏小
+	ExactTotalHits bool
+}
+
+// 一条检索结果
+type Hit struct {
+	DocumentID int     // 文档编号
+	Title      string  // 文档标题
+	Score      float64 // 检索得分
+}
+
+// 检索的统计信息
+type SearchStats struct {
+	TotalHits      int           // 匹配的文档总数
+	TotalHitsExact bool          // TotalHits 是否准确，为 false 时它只是匹配的文档数的下限
+	Took           time.Duration // 检索所用的时间
+}
+
+// 进行全文检索
+// ctx 被取消时中止检索并返回 ctx.Err()
+// q 查询字符串，语法见 ParseQuery
+// opts 检索选项，可以为 nil
+// 返回按得分降序排列的检索结果，得分相同时按文档编号的升序排列
+func (env *WiserEnv) Search(ctx context.Context, q string, opts *SearchOptions) ([]Hit, SearchStats, error) {
+	start := time.Now()
+	var stats SearchStats
+	if opts == nil {
+		opts = &SearchOptions{}
+	}
+	if opts.Limit < 0 || opts.Offset < 0 {
+		return nil, stats, fmt.Errorf("invalid limit %d or offset %d", opts.Limit, opts.Offset)
+	}
+	// 查询要按建立索引时的设置分割为词元
+	err := env.syncSettings()
+	if err != nil {
+		return nil, stats, err
+	}
+	scorer := opts.Scorer
+	if scorer == nil {
+		scorer = env.Scorer
+	}
+	// 只需保留前 offset + limit 个结果
+	k := 0
+	if opts.Limit > 0 {
+		k = opts.Offset + opts.Limit
+	}
+	var after *SearchResult
+	if opts.SearchAfter != nil {
+		after = &SearchResult{DocumentID: opts.SearchAfter.DocumentID, Score: opts.SearchAfter.Score}
+	}
+	// 1. 将查询字符串解析为语法树
+	query, err := ParseQuery(q)
+	if err != nil {
+		return nil, stats, err
+	}
+	// 2. 以语法树为参数，开始进行检索处理
+	results := newTopKResults(k, after)
+	err = env.searchDocs(ctx, query, scorer, !opts.ExactTotalHits, results)
+	if err != nil {
+		return nil, stats, err
+	}
+	// 3. 从存储器中取出检索结果的文档标题
+	items := results.sorted()
+	if opts.Offset < len(items) {
+		items = items[opts.Offset:]
+	} else {
+		items = nil
+	}
+	hits := make([]Hit, len(items))
+	for i, r := range items {
+		title, err := env.Store.GetDocumentTitle(r.DocumentID)
+		if err != nil {
+			return nil, stats, err
+		}
+		hits[i] = Hit{DocumentID: r.DocumentID, Title: title, Score: r.Score}
+	}
+	stats.TotalHits = results.total
+	stats.TotalHitsExact = !results.pruned
+	stats.Took = time.Since(start)
+	return hits, stats, nil
 }
 
 // 从查询字符串中提取出词元的信息
 // text 查询字符串
 // query_tokens 按词元编号存储位置信息序列的关联数组
-//              若传入的是指向nil的指针，则新建一个关联数组
+//
+//	若传入的是指向nil的指针，则新建一个关联数组
 func (env *WiserEnv) splitQueryToTokens(text string) (*QueryTokenHash, error) {
 	// 将文档编号设置为0
-	err := env.TextToPostingsLists(0, text)
-	return env.IIBuffer, err
+	queryTokens := NewInvertedIndexHash()
+	_, err := env.TextToPostingsLists(0, text, queryTokens)
+	return queryTokens, err
 }
 
 // 检索文档
+// query 查询语法树
+// scorer 计算得分的方法
+// prune 是否跳过不可能进入检索结果的文档
 // results 检索结果
-// tokens 从查询中提取出的词元信息
-func (env *WiserEnv) searchDocs(tokens *QueryTokenHash, results *SearchResultHash) {
-	var err error
-	nTokens := len(tokens.HashMap)
+func (env *WiserEnv) searchDocs(ctx context.Context, query *QueryNode, scorer Scorer, prune bool,
+	results *topKResults) error {
+	stats, err := env.collectionStats()
+	if err != nil {
+		return err
+	}
+	// 已删除但尚未清除的文档依然在倒排列表中，需要从检索结果中排除
+	deleted, err := env.deletedDocuments()
+	if err != nil {
+		return err
+	}
+	sc := &scoreContext{scorer: scorer, stats: stats}
+	var cursor queryCursor
+	if prune && results.k > 0 && query.Op == QueryOr {
+		// 只需要前 k 个结果时，对 OR 查询进行动态剪枝
+		cursor, err = env.openWandCursor(query, sc, results)
+	} else {
+		cursor, err = env.openQueryCursor(query, sc)
+	}
+	if err != nil {
+		return err
+	}
+	for n := 0; !cursor.Done(); n++ {
+		// 每处理一定数量的文档检查一次是否被取消
+		if n%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		if !deleted[cursor.DocumentID()] {
+			score, err := cursor.Score()
+			if err != nil {
+				return err
+			}
+			results.add(cursor.DocumentID(), score)
+		}
+		err = cursor.Next()
+		if err != nil {
+			return err
+		}
+	}
+	if w, ok := cursor.(*wandCursor); ok && w.pruned {
+		results.pruned = true
+	}
+	return nil
+}
+
+// 按文档编号的升序遍历与查询语法树中某个节点匹配的文档的游标
+type queryCursor interface {
+	// 是否已经遍历完所有的文档
+	Done() bool
+	// 当前的文档编号
+	DocumentID() int
+	// 将游标移动到下一个文档
+	Next() error
+	// 将游标移动到文档编号不小于 documentID 的第一个文档
+	SkipTo(documentID int) error
+	// 当前文档的得分
+	Score() (float64, error)
+	// 所有文档的得分的上限
+	MaxScore() float64
+	// 从文档编号不小于 documentID 的第一个文档所在的块开始，到返回的文档编号为止，
+	// 这一范围内的文档的得分的上限
+	BlockMaxScore(documentID int) (float64, int)
+}
+
+// 为查询语法树打开游标，游标指向第一个匹配的文档
+// NOT 节点要求文档不匹配，单独使用时需要遍历所有的文档，因此只允许作为 AND 的子节点出现，
+// 并且该 AND 节点中至少要有一个不是 NOT 的子节点。
+// 无法提取出词元的检索词无论出现在哪里，都从其所在的 AND 或 OR 中去除；
+// 子节点都被去除的 AND 或 OR 也从上一层中去除，整个查询都被去除时返回 errTooShortQuery。
+func (env *WiserEnv) openQueryCursor(node *QueryNode, sc *scoreContext) (queryCursor, error) {
+	switch node.Op {
+	case QueryTerm, QueryPhrase:
+		return env.openTermCursor(node, sc)
+	case QueryAnd:
+		cursor := &andCursor{}
+		var tooShort error
+		for _, child := range node.Children {
+			excluded := child.Op == QueryNot
+			if excluded {
+				child = child.Children[0]
+			}
+			c, err := env.openQueryCursor(child, sc)
+			if errors.Is(err, errTooShortQuery) {
+				if !excluded {
+					tooShort = err
+				}
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if excluded {
+				cursor.excluded = append(cursor.excluded, c)
+			} else {
+				cursor.children = append(cursor.children, c)
+			}
+		}
+		if len(cursor.children) == 0 {
+			if tooShort != nil {
+				return nil, tooShort
+			}
+			return nil, fmt.Errorf("query %s has no positive term", node)
+		}
+		return cursor, cursor.match()
+	case QueryOr:
+		children, err := env.openOrChildren(node, sc)
+		if err != nil {
+			return nil, err
+		}
+		return &orCursor{children: children}, nil
+	default:
+		return nil, fmt.Errorf("query %s has no positive term", node)
+	}
+}
+
+// 为 OR 节点的子节点打开游标
+// 无法提取出词元的子节点被去除，所有子节点都被去除时返回 errTooShortQuery
+func (env *WiserEnv) openOrChildren(node *QueryNode, sc *scoreContext) ([]queryCursor, error) {
+	var children []queryCursor
+	var tooShort error
+	for _, child := range node.Children {
+		c, err := env.openQueryCursor(child, sc)
+		if errors.Is(err, errTooShortQuery) {
+			tooShort = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, c)
+	}
+	if len(children) == 0 && tooShort != nil {
+		return nil, tooShort
+	}
+	return children, nil
+}
+
+// 查询中的检索词都无法提取出词元
+var errTooShortQuery = errors.New("too short query")
+
+// 与检索词或短语匹配的文档的游标
+// 检索词中的所有词元都出现在文档中时匹配，短语还要求这些词元的出现位置与它们在查询中的位置一致
+type termCursor struct {
+	env         *WiserEnv
+	tokens      *QueryTokenHash    // 从检索词中提取出的词元信息
+	cursors     []*DocSearchCursor // 各词元的文档检索游标
+	sc          *scoreContext      // 计算得分的方法和整个索引的统计信息
+	phrase      bool               // 是否进行短语检索
+	phraseCount int                // 短语在当前文档中出现的次数
+	maxScore    float64            // 得分的上限，第一次调用 MaxScore 时才计算
+	maxScored   bool               // 是否已计算得分的上限
+	done        bool
+}
+
+// 打开与检索词或短语匹配的文档的游标
+func (env *WiserEnv) openTermCursor(node *QueryNode, sc *scoreContext) (*termCursor, error) {
+	tokens, err := env.splitQueryToTokens(node.Text)
+	if err != nil {
+		return nil, err
+	}
+	nTokens := len(tokens.Items)
 	if nTokens == 0 {
-		return
+		return nil, fmt.Errorf("%w: %s", errTooShortQuery, node.Text)
 	}
-	var cursors = make([]*DocSearchCursor, nTokens)
-	for i := range cursors {
-		cursors[i] = &DocSearchCursor{}
+	c := &termCursor{
+		env:     env,
+		tokens:  tokens,
+		cursors: make([]*DocSearchCursor, nTokens),
+		sc:      sc,
+		phrase:  node.Op == QueryPhrase || env.EnablePharseSearch != 0,
 	}
-	// 按照文档频率的升序堆tokens排序
+	// 按照文档频率的升序对tokens排序
 	// 比较出现过词元a和词元b的文档数
 	sort.Slice(tokens.Items, func(i, j int) bool {
 		return tokens.Items[i].DocsCount < tokens.Items[j].DocsCount
 	})
-	// 初始化
-	if nTokens != 0 {
-		var token = tokens.Items[0]
-		for i := 0; i < nTokens; i++ {
-			if token.TokenID == 0 {
-				// 当前的token在构建索引的过程中从未出现过
-				return
-			}
-			cursors[i].Documents, _, err = FetchPostings(token.TokenID)
+	for i, token := range tokens.Items {
+		if token.TokenID == 0 {
+			// 当前的token在构建索引的过程中从未出现过
+			c.done = true
+			return c, nil
+		}
+		c.cursors[i], err = env.openDocSearchCursor(token.TokenID)
+		if err != nil {
+			return nil, fmt.Errorf("decode postings error! : %d: %v", token.TokenID, err)
+		}
+		if c.cursors[i] == nil {
+			// 虽然当前的token存在，但是由于更新或删除导致其倒排列表为空
+			c.done = true
+			return c, nil
+		}
+	}
+	return c, c.match()
+}
+
+func (c *termCursor) Done() bool {
+	return c.done
+}
+
+func (c *termCursor) DocumentID() int {
+	return c.cursors[0].DocumentID()
+}
+
+func (c *termCursor) Next() error {
+	if c.done {
+		return nil
+	}
+	err := c.cursors[0].Next()
+	if err != nil {
+		return err
+	}
+	return c.match()
+}
+
+func (c *termCursor) SkipTo(documentID int) error {
+	if c.done || c.DocumentID() >= documentID {
+		return nil
+	}
+	err := c.cursors[0].SkipTo(documentID)
+	if err != nil {
+		return err
+	}
+	return c.match()
+}
+
+func (c *termCursor) Score() (float64, error) {
+	return c.env.calcScore(c.sc, c.tokens, c.cursors, c.phraseCount)
+}
+
+// 得分的上限是各词元的得分的上限之和
+func (c *termCursor) MaxScore() float64 {
+	if c.done {
+		return 0
+	}
+	if !c.maxScored {
+		c.maxScored = true
+		for _, qt := range c.tokens.Items {
+			n, err := c.env.Store.GetTokenMaxTermFrequency(qt.TokenID)
 			if err != nil {
-				fmt.Printf("decode postings error! : %d\n", token.TokenID)
-				return
-			}
-			if cursors[i].Documents == nil {
-				// 虽然当前的token存在，但是由于更新或删除导致其他倒排类别为空
-				return
-			}
-			cursors[i].Current = cursors[i].Documents
-			if i + 1 < nTokens {
-				token = tokens.Items[i+1]
-			}
-		}
-		for cursors[0].Current != nil {
-			var docId, nextDocId int
-			// 将拥有文档最少的词元称为A
-			docId = cursors[0].Current.DocumentID
-			// 对于除词元A以外的词元，不断获取其下一个DocumentID，
-			// 直到当前的document_id不小于词元A的document_id为止
-			for i := 1; i < nTokens; i++ {
-				cur := cursors[i]
-				for cur.Current != nil && cur.Current.DocumentID < docId {
-					cur.Current = cur.Current.Next
-				}
-				if cur.Current == nil {
-					return
-				}
-				// 对于除词元A以外的词元，如果其document_id不等于词元A的document_id
-				// 那么就将这个document_id设定为next_doc_id
-				if cur.Current.DocumentID != docId {
-					nextDocId = cur.Current.DocumentID
-					break
+				// 无法获取时不对得分的上限做任何假设
+				n = 0
+			}
+			c.maxScore += c.sc.scorerOrDefault().MaxScore(c.sc.stats, n, qt.DocsCount)
+		}
+	}
+	return c.maxScore
+}
+
+// 使用块中记录的词元的最大出现次数计算得分的上限
+func (c *termCursor) BlockMaxScore(documentID int) (float64, int) {
+	maxScore := c.MaxScore()
+	if c.done {
+		return 0, math.MaxInt32
+	}
+	var score float64
+	last := math.MaxInt32
+	for i, qt := range c.tokens.Items {
+		maxTF, blockLast, ok := c.cursors[i].blockMax(documentID)
+		if !ok {
+			// 该词元不再出现，之后的文档都不可能匹配
+			return 0, math.MaxInt32
+		}
+		score += c.sc.scorerOrDefault().MaxScore(c.sc.stats, maxTF, qt.DocsCount)
+		if blockLast < last {
+			last = blockLast
+		}
+	}
+	if score > maxScore {
+		score = maxScore
+	}
+	return score, last
+}
+
+// 从当前的文档开始，找到第一个包含所有词元的文档
+func (c *termCursor) match() error {
+	cursors := c.cursors
+	for !cursors[0].Done() {
+		// 将拥有文档最少的词元称为A
+		docId := cursors[0].DocumentID()
+		nextDocId := 0
+		// 对于除词元A以外的词元，跳到不小于词元A的document_id的文档
+		for _, cur := range cursors[1:] {
+			err := cur.SkipTo(docId)
+			if err != nil {
+				return err
+			}
+			if cur.Done() {
+				c.done = true
+				return nil
+			}
+			// 对于除词元A以外的词元，如果其document_id不等于词元A的document_id
+			// 那么就将这个document_id设定为next_doc_id
+			if cur.DocumentID() != docId {
+				nextDocId = cur.DocumentID()
+				break
+			}
+		}
+		if nextDocId > 0 {
+			// 将A跳到不小于next_doc_id的文档
+			err := cursors[0].SkipTo(nextDocId)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		// 所有词元都出现在了该文档中
+		// 进行短语检索时，还要求这些词元的出现位置与它们在查询中的位置一致
+		if !c.phrase {
+			c.phraseCount = 0
+			return nil
+		}
+		c.phraseCount = searchPhrase(c.tokens, cursors)
+		if c.phraseCount > 0 {
+			return nil
+		}
+		err := cursors[0].Next()
+		if err != nil {
+			return err
+		}
+	}
+	c.done = true
+	return nil
+}
+
+// 与所有子节点都匹配，并且与所有 NOT 子节点都不匹配的文档的游标（交集与差集）
+type andCursor struct {
+	children []queryCursor // 要求匹配的子节点
+	excluded []queryCursor // 要求不匹配的子节点
+	done     bool
+}
+
+func (c *andCursor) Done() bool {
+	return c.done
+}
+
+func (c *andCursor) DocumentID() int {
+	return c.children[0].DocumentID()
+}
+
+func (c *andCursor) Next() error {
+	if c.done {
+		return nil
+	}
+	err := c.children[0].Next()
+	if err != nil {
+		return err
+	}
+	return c.match()
+}
+
+func (c *andCursor) SkipTo(documentID int) error {
+	if c.done || c.DocumentID() >= documentID {
+		return nil
+	}
+	err := c.children[0].SkipTo(documentID)
+	if err != nil {
+		return err
+	}
+	return c.match()
+}
+
+// 得分是所有子节点的得分之和
+func (c *andCursor) Score() (float64, error) {
+	var score float64
+	for _, child := range c.children {
+		s, err := child.Score()
+		if err != nil {
+			return 0, err
+		}
+		score += s
+	}
+	return score, nil
+}
+
+func (c *andCursor) MaxScore() float64 {
+	if c.done {
+		return 0
+	}
+	return sumMaxScore(c.children)
+}
+
+func (c *andCursor) BlockMaxScore(documentID int) (float64, int) {
+	if c.done {
+		return 0, math.MaxInt32
+	}
+	return sumBlockMaxScore(c.children, documentID)
+}
+
+// 从当前的文档开始，找到第一个满足条件的文档
+func (c *andCursor) match() error {
+	first := c.children[0]
+search:
+	for !first.Done() {
+		docId := first.DocumentID()
+		for _, child := range c.children[1:] {
+			err := child.SkipTo(docId)
+			if err != nil {
+				return err
+			}
+			if child.Done() {
+				break search
+			}
+			if child.DocumentID() != docId {
+				err = first.SkipTo(child.DocumentID())
+				if err != nil {
+					return err
 				}
+				continue search
 			}
-			if nextDocId > 0 {
-				// 不断获取A的下一个document_id，直到其当前的document_id不小于next_doc_id为止
-				for cursors[0].Current != nil && cursors[0].Current.DocumentID < nextDocId {
-					cursors[0].Current = cursors[0].Current.Next
+		}
+		// 排除与 NOT 子节点匹配的文档
+		for _, ex := range c.excluded {
+			err := ex.SkipTo(docId)
+			if err != nil {
+				return err
+			}
+			if !ex.Done() && ex.DocumentID() == docId {
+				err = first.Next()
+				if err != nil {
+					return err
 				}
-			} else {
-				score := calcTfIdf(tokens, cursors[0], nTokens, env.IndexedCount)
-				addSearchResult(results, docId, score)
+				continue search
+			}
+		}
+		return nil
+	}
+	c.done = true
+	return nil
+}
+
+// 与任意一个子节点匹配的文档的游标（并集）
+type orCursor struct {
+	children []queryCursor
+}
+
+func (c *orCursor) Done() bool {
+	for _, child := range c.children {
+		if !child.Done() {
+			return false
+		}
+	}
+	return true
+}
 
-				cursors[0].Current = cursors[0].Current.Next
+// 当前的文档编号是各子节点的文档编号中最小的一个
+func (c *orCursor) DocumentID() int {
+	id := 0
+	for _, child := range c.children {
+		if !child.Done() && (id == 0 || child.DocumentID() < id) {
+			id = child.DocumentID()
+		}
+	}
+	return id
+}
+
+func (c *orCursor) Next() error {
+	id := c.DocumentID()
+	for _, child := range c.children {
+		if !child.Done() && child.DocumentID() == id {
+			err := child.Next()
+			if err != nil {
+				return err
 			}
 		}
 	}
-	sort.Slice(results.Item, func(i, j int) bool {
-		return results.Item[i].Score > results.Item[j].Score
-	})
+	return nil
 }
 
-// 以检索结果中的文档编号为查询条件，从文档数据库中取出相应的文档标题，
-// 最后输出获取到的标题和检索的得分
-func printSearchResults(res *SearchResultHash) {
-	if res == nil {
-		return
+func (c *orCursor) SkipTo(documentID int) error {
+	for _, child := range c.children {
+		err := child.SkipTo(documentID)
+		if err != nil {
+			return err
+		}
 	}
-	n := len(res.HashMap)
-	for k, v := range res.HashMap {
-		r := v
-		delete(res.HashMap, k)
-		title, _ := dao.GetDocumentTitle(r.documentID)
-		fmt.Printf("document_id: %d title: %s score: %.2f\n", r.documentID, title, r.Score)
+	return nil
+}
+
+func (c *orCursor) MaxScore() float64 {
+	return sumMaxScore(c.children)
+}
+
+func (c *orCursor) BlockMaxScore(documentID int) (float64, int) {
+	return sumBlockMaxScore(c.children, documentID)
+}
+
+// 得分是与当前文档匹配的子节点的得分之和
+func (c *orCursor) Score() (float64, error) {
+	id := c.DocumentID()
+	var score float64
+	for _, child := range c.children {
+		if !child.Done() && child.DocumentID() == id {
+			s, err := child.Score()
+			if err != nil {
+				return 0, err
+			}
+			score += s
+		}
 	}
-	fmt.Printf("Total %d document are found!\n", n)
+	return score, nil
 }
 
-// 用TF-IDF计算得分
-// query_tokens 查询
-// doc_cursors 用于文档检索的游标的集合
-// n_query_tokens 查询中的词元数
-// indexed_count 建立过索引的文档总数
-// return 得分
-func calcTfIdf(queryTokens *QueryTokenHash, docCursors *DocSearchCursor,
-	nQueryTokens int, indexedCount int) float64 {
-	var dcur = docCursors.Current
+// 检查文档中是否存在与查询一致的短语
+// 对于查询中的每个词元，文档中的出现位置减去其在查询中的位置得到相对位置，
+// 所有词元的相对位置都相同时，说明这些词元在文档中连续地出现，构成了与查询一致的短语。
+// query tokens 从查询中提取出的词元信息
+// doc cursors 各词元的文档检索游标，都指向同一个文档
+// 返回短语在文档中出现的次数
+func searchPhrase(queryTokens *QueryTokenHash, docCursors []*DocSearchCursor) int {
+	// 词元在查询中出现多次时，为每次出现都创建一个游标
+	var cursors []*PhraseSearchCursor
+	for i, qt := range queryTokens.Items {
+		for _, base := range qt.PostingsList.DocumentPositions(0) {
+			cursors = append(cursors, &PhraseSearchCursor{
+				Positions: docCursors[i].Positions(),
+				Base:      base,
+				Current:   0,
+			})
+		}
+	}
+	if len(cursors) == 0 {
+		return 0
+	}
+
+	phraseCount := 0
+	first := cursors[0]
+	for first.Current < len(first.Positions) {
+		relPos := first.Positions[first.Current] - first.Base
+		nextRelPos := relPos
+		// 对于其他游标，不断获取下一个位置，直到其相对位置不小于 relPos 为止
+		for _, cur := range cursors[1:] {
+			for cur.Current < len(cur.Positions) && cur.Positions[cur.Current]-cur.Base < relPos {
+				cur.Current++
+			}
+			if cur.Current == len(cur.Positions) {
+				return phraseCount
+			}
+			if cur.Positions[cur.Current]-cur.Base != relPos {
+				nextRelPos = cur.Positions[cur.Current] - cur.Base
+				break
+			}
+		}
+		if nextRelPos > relPos {
+			// 不断获取第一个游标的下一个位置，直到其相对位置不小于 nextRelPos 为止
+			for first.Current < len(first.Positions) && first.Positions[first.Current]-first.Base < nextRelPos {
+				first.Current++
+			}
+		} else {
+			// 找到了短语
+			phraseCount++
+			first.Current++
+		}
+	}
+	return phraseCount
+}
+
+// 各游标的得分的上限之和
+func sumMaxScore(cursors []queryCursor) float64 {
 	var score float64
-	for i := 0; i < nQueryTokens; i++ {
-		qt := queryTokens.Items[i]
-		idf := indexedCount / qt.DocsCount
-		score += float64(dcur.PositionsCount * idf)
-		dcur = dcur.Next
+	for _, c := range cursors {
+		score += c.MaxScore()
 	}
 	return score
 }
 
-// 将文档添加到检索结果中
-// results 指向检索结果的指针
-// document_id 要添加的文档的编号
-// score 得分
-func addSearchResult(result *SearchResultHash, documentID int, score float64) {
-	r := &SearchResult{}
-	if v, ok := result.HashMap[documentID]; ok {
-		r = v
-		r.Score += score
-	} else {
-		r.documentID = documentID
-		r.Score = 0
-		result.HashMap = make(map[int]*SearchResult)
-		result.HashMap[documentID] = r
+// 各游标在块中的得分的上限之和，范围取各游标的范围中最小的一个
+func sumBlockMaxScore(cursors []queryCursor, documentID int) (float64, int) {
+	var score float64
+	last := math.MaxInt32
+	for _, c := range cursors {
+		s, l := c.BlockMaxScore(documentID)
+		score += s
+		if l < last {
+			last = l
+		}
 	}
+	return score, last
 }
@@ -0,0 +1,257 @@
+package logic
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 构造包含指定文档编号的倒排列表
+func makeDocuments(ids []int) *PostingsList {
+	docs := make(map[int][]int, len(ids))
+	for _, id := range ids {
+		docs[id] = []int{id % 7}
+	}
+	return makePostings(docs, ids...)
+}
+
+// 新建指向存储中的倒排列表的游标
+func newTestCursor(t testing.TB, env *WiserEnv, token string, ids []int) *DocSearchCursor {
+	if err := env.Store.StoreToken(token, nil); err != nil {
+		t.Fatal(err)
+	}
+	tokenID, _, _ := env.Store.GetTokenID(token)
+	buf, err := env.EncodePostings(makeDocuments(ids))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Store.UpdatePostings(tokenID, len(ids), 1, buf); err != nil {
+		t.Fatal(err)
+	}
+	cursor, err := env.openDocSearchCursor(tokenID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cursor
+}
+
+func TestDocSearchCursorSkipTo(t *testing.T) {
+	var ids []int
+	for id := 3; id < 3000; id += 3 {
+		ids = append(ids, id)
+	}
+	for _, method := range []string{"vbyte", "golomb", "none"} {
+		env := newTestEnv()
+		env.Compress, _ = ParseCompressMethod(method)
+		env.settingsSynced = true
+		cursor := newTestCursor(t, env, "数学", ids)
+
+		tests := []struct{ target, want int }{
+			{1, 3}, {3, 3}, {4, 6}, {385, 387}, {386, 387}, {1500, 1500}, {2997, 2997},
+		}
+		for _, tt := range tests {
+			if err := cursor.SkipTo(tt.target); err != nil {
+				t.Fatal(err)
+			}
+			if cursor.Done() || cursor.DocumentID() != tt.want {
+				t.Fatalf("%s: SkipTo(%d) stopped at wrong document, want %d", method, tt.target, tt.want)
+			}
+			if got := cursor.Positions(); len(got) != 1 || got[0] != tt.want%7 {
+				t.Fatalf("%s: positions of %d = %v", method, tt.want, got)
+			}
+		}
+		if cursor.Next(); !cursor.Done() {
+			t.Errorf("%s: Next after last document = %d", method, cursor.DocumentID())
+		}
+
+		// 逐个遍历时得到所有的文档
+		cursor, _ = env.openDocSearchCursor(1)
+		var n int
+		for ; !cursor.Done(); cursor.Next() {
+			if cursor.DocumentID() != ids[n] {
+				t.Fatalf("%s: document %d = %d, want %d", method, n, cursor.DocumentID(), ids[n])
+			}
+			n++
+		}
+		if n != len(ids) {
+			t.Errorf("%s: iterated %d documents, want %d", method, n, len(ids))
+		}
+		cursor, _ = env.openDocSearchCursor(1)
+		if cursor.SkipTo(5000); !cursor.Done() {
+			t.Errorf("%s: SkipTo past the end = %d", method, cursor.DocumentID())
+		}
+	}
+}
+
+// 求两个游标的交集，skip 为 false 时逐个移动游标
+func intersect(a, b PostingsIterator, skip bool) int {
+	var n int
+	for !a.Done() && !b.Done() {
+		switch {
+		case a.DocumentID() == b.DocumentID():
+			n++
+			a.Next()
+			b.Next()
+		case a.DocumentID() < b.DocumentID():
+			if skip {
+				a.SkipTo(b.DocumentID())
+			} else {
+				a.Next()
+			}
+		default:
+			if skip {
+				b.SkipTo(a.DocumentID())
+			} else {
+				b.Next()
+			}
+		}
+	}
+	return n
+}
+
+// 求罕见词元和常见词元的倒排列表的交集
+func BenchmarkIntersect(b *testing.B) {
+	var common, rare []int
+	for id := 1; id <= 200000; id++ {
+		common = append(common, id)
+		if id%20000 == 0 {
+			rare = append(rare, id)
+		}
+	}
+	env := newTestEnv()
+	env.Compress = CompressMethod{CompressVByte: true}
+	env.settingsSynced = true
+	newTestCursor(b, env, "common", common)
+	newTestCursor(b, env, "rare", rare)
+	commonID, _, _ := env.Store.GetTokenID("common")
+	rareID, _, _ := env.Store.GetTokenID("rare")
+
+	for _, skip := range []bool{false, true} {
+		b.Run(fmt.Sprintf("skip=%v", skip), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				c, _ := env.openDocSearchCursor(commonID)
+				r, _ := env.openDocSearchCursor(rareID)
+				if n := intersect(r, c, skip); n != len(rare) {
+					b.Fatalf("intersection has %d documents, want %d", n, len(rare))
+				}
+			}
+		})
+	}
+}
+
+// 将 wiki.xml 中的每个段落作为一个文档建立索引，然后进行检索
+func BenchmarkSearchWiki(b *testing.B) {
+	f, err := os.Open("../wiki.xml")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	env := newTestEnv()
+	env.Compress = CompressMethod{CompressVByte: true}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for n := 0; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len([]rune(line)) < 10 {
+			continue
+		}
+		if err := env.AddDocument(fmt.Sprintf("段落%d", n), line); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := env.AddDocument("", ""); err != nil {
+		b.Fatal(err)
+	}
+	// skip=false 时逐个文档求交集，与使用跳跃表的情况比较
+	for _, q := range []string{"数学", "几何学", "数学的基础"} {
+		for _, skip := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/skip=%v", q, skip), func(b *testing.B) {
+				env.disableSkip = !skip
+				for i := 0; i < b.N; i++ {
+					search(b, env, q)
+				}
+			})
+		}
+	}
+}
+
+// 检索并返回文档编号
+func searchIDs(t testing.TB, env *WiserEnv, q string) []int {
+	var ids []int
+	for _, r := range search(t, env, q) {
+		ids = append(ids, r.DocumentID)
+	}
+	return ids
+}
+
+func TestPhraseSearch(t *testing.T) {
+	env := newTestEnv()
+	addDocuments(t, env,
+		"甲", "东京都的天气",
+		"乙", "东京和京都",
+		"丙", "东京都和东京都",
+		"丁", "京都东京")
+	env.IndexedCount = 4
+
+	if got := searchIDs(t, env, "东京都"); len(got) != 4 {
+		t.Errorf("search without phrase = %v, want 4 documents", got)
+	}
+	env.EnablePharseSearch = 1
+	got := searchIDs(t, env, "东京都")
+	if !reflect.DeepEqual(got, []int{3, 1}) {
+		t.Errorf("phrase search = %v, want [3 1]", got)
+	}
+	if got := searchIDs(t, env, "京都东京"); !reflect.DeepEqual(got, []int{4}) {
+		t.Errorf("phrase search of 京都东京 = %v, want [4]", got)
+	}
+	// 查询中重复出现的词元
+	addDocuments(t, env, "戊", "哈哈哈", "己", "哈哈")
+	env.IndexedCount = 6
+	if got := searchIDs(t, env, "哈哈哈"); !reflect.DeepEqual(got, []int{5}) {
+		t.Errorf("phrase search of 哈哈哈 = %v, want [5]", got)
+	}
+}
+
+func TestSearchAPI(t *testing.T) {
+	env := newTestEnv()
+	addDocuments(t, env,
+		"甲", "东京都的天气",
+		"乙", "京都的寺庙",
+		"丙", "东京的夜景，东京的美食")
+
+	hits, stats, err := env.Search(context.Background(), "东京", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalHits != 2 || len(hits) != 2 {
+		t.Fatalf("TotalHits = %d, len(hits) = %d; want 2", stats.TotalHits, len(hits))
+	}
+	if hits[0].DocumentID != 3 || hits[0].Title != "丙" || hits[1].Title != "甲" {
+		t.Errorf("hits = %+v", hits)
+	}
+	if hits[0].Score <= hits[1].Score {
+		t.Errorf("hits not sorted by score: %+v", hits)
+	}
+
+	// 检索选项中的方法优先于运行环境中设置的方法
+	bm25, _, err := env.Search(context.Background(), "东京", &SearchOptions{Scorer: NewBM25Scorer()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bm25[0].Score == hits[0].Score {
+		t.Errorf("scorer option ignored")
+	}
+
+	if _, _, err := env.Search(context.Background(), "(东京", nil); err == nil {
+		t.Error("Search with syntax error succeeded")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := env.Search(ctx, "东京", nil); err != context.Canceled {
+		t.Errorf("Search with canceled context: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package logic
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// 分词使用的词典
+type Dictionary struct {
+	words  map[string]bool
+	maxLen int // 最长的词的字符数
+}
+
+// 新建空的词典
+func NewDictionary() *Dictionary {
+	return &Dictionary{words: make(map[string]bool)}
+}
+
+// 从文件中读取词典
+// 每行一个词，词后面可以用空白分隔出词频和词性等其他字段，这些字段会被忽略；
+// 空行和以 # 开头的行也会被忽略。
+// path 词典文件的路径
+func LoadDictionary(path string) (*Dictionary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	d := NewDictionary()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		d.Add(fields[0])
+	}
+	return d, scanner.Err()
+}
+
+// 计算词典文件内容的校验和，用于检查词典在建立索引之后是否被修改
+func DictionaryChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// 向词典中添加词
+// 词与文本一样经过规范化，以便与规范化后的文本进行匹配
+func (d *Dictionary) Add(word string) {
+	word = string(NormalizeFilter{}.Filter([]rune(word)))
+	n := utf8.RuneCountInString(word)
+	if n == 0 {
+		return
+	}
+	d.words[word] = true
+	if n > d.maxLen {
+		d.maxLen = n
+	}
+}
+
+// 词典中是否有该词
+func (d *Dictionary) Contains(word string) bool {
+	return d.words[word]
+}
+
+// 根据词典进行分词的分词器
+// 单词和数字与 MixedTokenizer 同样处理；汉字等其他文字连续出现的部分使用正向最大匹配法分词，
+// 即从前往后每次取出词典中最长的词，词典中没有的字符单独作为词元。
+// 与 N-gram 相比，“东京都”被分为“东京都”一个词元，检索“京都”时不会匹配，
+// 提高了检索结果的准确率，但检索“东京”时也不会匹配，召回率有所降低。
+// 词元的位置与 MixedTokenizer 同样按词元的序号计算。
+type DictTokenizer struct {
+	Dict *Dictionary
+}
+
+func (t DictTokenizer) Tokenize(text []rune) []Token {
+	var p tokenPositions
+	scanScripts(text, p.add, func(run []rune) {
+		for i := 0; i < len(run); {
+			n := t.match(run[i:])
+			p.add(string(run[i : i+n]))
+			i += n
+		}
+	}, p.skip)
+	return p.tokens
+}
+
+// 返回从文本开头开始的、词典中最长的词的字符数，没有匹配的词时返回 1
+func (t DictTokenizer) match(text []rune) int {
+	n := t.Dict.maxLen
+	if n > len(text) {
+		n = len(text)
+	}
+	for ; n > 1; n-- {
+		if t.Dict.Contains(string(text[:n])) {
+			return n
+		}
+	}
+	return 1
+}
+
+// 新建根据词典进行分词的分析器
+func NewDictAnalyzer(dict *Dictionary) *PipelineAnalyzer {
+	return &PipelineAnalyzer{
+		AnalyzerName: AnalyzerDict,
+		CharFilters:  []CharFilter{NormalizeFilter{}},
+		Tokenizer:    DictTokenizer{Dict: dict},
+	}
+}
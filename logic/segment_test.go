@@ -0,0 +1,126 @@
+package logic
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/read-talk/wiser/dao"
+)
+
+// 将词典写入临时文件，返回文件的路径
+func writeDictionary(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "wiser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "user.dict")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testDictionary = `# 测试用的词典
+东京 100 ns
+东京都 50 ns
+京都 80 ns
+天气
+ＡＰＩ接口
+`
+
+func TestLoadDictionary(t *testing.T) {
+	d, err := LoadDictionary(writeDictionary(t, testDictionary))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range []string{"东京", "东京都", "京都", "天气", "api接口"} {
+		if !d.Contains(w) {
+			t.Errorf("dictionary does not contain %q", w)
+		}
+	}
+	if d.Contains("100") || d.Contains("#") || d.maxLen != 5 {
+		t.Errorf("unexpected dictionary: %v, max length %d", d.words, d.maxLen)
+	}
+	if _, err := LoadDictionary(filepath.Join(os.TempDir(), "no-such-wiser.dict")); err == nil {
+		t.Error("LoadDictionary of missing file succeeded")
+	}
+}
+
+func TestDictTokenizer(t *testing.T) {
+	d := NewDictionary()
+	for _, w := range []string{"东京", "东京都", "京都", "天气"} {
+		d.Add(w)
+	}
+	got := NewDictAnalyzer(d).Analyze("东京都的天气，京都iPhone 12")
+	want := []Token{{"东京都", 0}, {"的", 1}, {"天气", 2}, {"京都", 4}, {"iphone", 5}, {"12", 7}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Analyze = %v, want %v", got, want)
+	}
+}
+
+func TestDictSearch(t *testing.T) {
+	path := writeDictionary(t, testDictionary)
+	store := dao.NewMemoryStore()
+	env := NewEnv(store, 2048)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 使用相对路径指定词典时记录绝对路径
+	env.DictionaryPath, err = filepath.Rel(wd, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Analyzer, err = NewAnalyzer(AnalyzerDict, env.TokenLen, env.DictionaryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addDocuments(t, env, "甲", "东京都的天气", "乙", "京都的寺庙", "丙", "东京的夜景")
+	if v, _ := store.GetSettings(SettingDictionary); v != path {
+		t.Errorf("dictionary setting = %q, want %q", v, path)
+	}
+
+	// 重新打开索引时使用记录的词典
+	env = NewEnv(store, 2048)
+	if err := env.syncSettings(); err != nil {
+		t.Fatal(err)
+	}
+	if env.analyzer().Name() != AnalyzerDict || env.DictionaryPath != path {
+		t.Fatalf("analyzer = %s, dictionary = %q", env.analyzer().Name(), env.DictionaryPath)
+	}
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"京都", []int{2}},
+		{"东京", []int{3}},
+		{"东京都", []int{1}},
+		{"天气", []int{1}},
+	}
+	for _, tt := range tests {
+		ids := searchIDs(t, env, tt.query)
+		sort.Ints(ids)
+		if !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("search(%q) = %v, want %v", tt.query, ids, tt.want)
+		}
+	}
+
+	// 词典被修改后拒绝检索
+	if err := ioutil.WriteFile(path, []byte(testDictionary+"的天\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env = NewEnv(store, 2048)
+	if _, _, err := env.Search(context.Background(), "京都", nil); err == nil {
+		t.Error("Search with modified dictionary succeeded")
+	}
+
+	if _, err := NewAnalyzer(AnalyzerDict, 2, ""); err == nil {
+		t.Error("NewAnalyzer(dict) without dictionary succeeded")
+	}
+}
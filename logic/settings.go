@@ -0,0 +1,262 @@
+package logic
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+// 记录在 settings 表中的设置项
+const (
+	SettingCompressMethod  = "compress_method"   // 压缩倒排列表的方法
+	SettingTotalTokenCount = "total_token_count" // 所有文档的长度（词元数）之和
+	SettingAnalyzer        = "analyzer"          // 建立索引时使用的分析器
+	SettingTokenLen        = "token_len"         // 建立索引时使用的 N-gram 中 N 的取值
+	SettingDictionary      = "dictionary"        // dict 分析器使用的词典文件的绝对路径
+	SettingDictionaryHash  = "dictionary_hash"   // dict 分析器使用的词典文件内容的 SHA-256 校验和
+)
+
+// 使运行环境的设置与建立索引时记录在存储器中的设置保持一致
+// 存储器中已有记录时，以存储器中的设置为准，这样索引总能按写入时的方法解码；
+// 尚无记录时，将运行环境的设置写入存储器。
+func (env *WiserEnv) syncSettings() error {
+	if env.settingsSynced {
+		return nil
+	}
+	value, err := env.Store.GetSettings(SettingCompressMethod)
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		count, err := env.Store.GetDocumentCount()
+		if err != nil {
+			return err
+		}
+		// 在记录压缩方法之前建立的索引都没有压缩
+		if count > 0 {
+			env.Compress = CompressMethod{CompressNone: true}
+		}
+		err = env.Store.ReplaceSettings(SettingCompressMethod, env.Compress.String())
+		if err != nil {
+			return err
+		}
+	} else {
+		env.Compress, err = ParseCompressMethod(value)
+		if err != nil {
+			return err
+		}
+	}
+	err = env.syncTokenLen()
+	if err != nil {
+		return err
+	}
+	err = env.syncAnalyzer()
+	if err != nil {
+		return err
+	}
+	env.settingsSynced = true
+	return nil
+}
+
+// 使运行环境的 N-gram 中 N 的取值与建立索引时的取值保持一致
+// 取值不同时，查询分割出的词元与索引中的词元长度不同，无法检索到文档，
+// 因此改用建立索引时的取值重新新建分析器，无法新建时返回错误。
+func (env *WiserEnv) syncTokenLen() error {
+	value, err := env.Store.GetSettings(SettingTokenLen)
+	if err != nil {
+		return err
+	}
+	n := env.TokenLen
+	if value == "" {
+		count, err := env.Store.GetDocumentCount()
+		if err != nil {
+			return err
+		}
+		// 在记录 N 的取值之前建立的索引都使用 NGram
+		if count > 0 {
+			n = NGram
+		}
+	} else {
+		n, err = strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %s", SettingTokenLen, value)
+		}
+	}
+	if n != env.TokenLen {
+		if env.Analyzer != nil {
+			analyzer, err := NewAnalyzer(env.Analyzer.Name(), n, env.DictionaryPath)
+			if err != nil {
+				return fmt.Errorf("index was built with N=%d, but the analyzer uses N=%d: %w", n, env.TokenLen, err)
+			}
+			env.Analyzer = analyzer
+		}
+		env.TokenLen = n
+	}
+	if value == "" {
+		return env.Store.ReplaceSettings(SettingTokenLen, strconv.Itoa(env.TokenLen))
+	}
+	return nil
+}
+
+// 使运行环境的分析器与建立索引时使用的分析器保持一致
+// 查询必须与文档按相同的方法分割为词元，否则无法检索到文档
+func (env *WiserEnv) syncAnalyzer() error {
+	value, err := env.Store.GetSettings(SettingAnalyzer)
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		count, err := env.Store.GetDocumentCount()
+		if err != nil {
+			return err
+		}
+		// 在记录分析器之前建立的索引都使用以前的版本的 N-gram 分析器
+		if count > 0 && env.analyzer().Name() != AnalyzerNgram {
+			env.Analyzer = NewLegacyNgramAnalyzer(env.TokenLen)
+		}
+		if env.analyzer().Name() == AnalyzerDict {
+			err = env.recordDictionary()
+			if err != nil {
+				return err
+			}
+		}
+		return env.Store.ReplaceSettings(SettingAnalyzer, env.analyzer().Name())
+	}
+	dictionaryPath := env.DictionaryPath
+	if value == AnalyzerDict {
+		dictionaryPath, err = env.checkDictionary()
+		if err != nil {
+			return err
+		}
+	}
+	if value != env.analyzer().Name() || !sameFile(dictionaryPath, env.DictionaryPath) {
+		env.Analyzer, err = NewAnalyzer(value, env.TokenLen, dictionaryPath)
+		if err != nil {
+			return err
+		}
+		env.DictionaryPath = dictionaryPath
+	}
+	return nil
+}
+
+// 记录 dict 分析器使用的词典文件的绝对路径和校验和
+// 这样从其他目录打开索引时也能找到词典，并能发现词典是否被修改
+func (env *WiserEnv) recordDictionary() error {
+	path, err := filepath.Abs(env.DictionaryPath)
+	if err != nil {
+		return err
+	}
+	sum, err := DictionaryChecksum(path)
+	if err != nil {
+		return err
+	}
+	err = env.Store.ReplaceSettings(SettingDictionary, path)
+	if err != nil {
+		return err
+	}
+	env.DictionaryPath = path
+	return env.Store.ReplaceSettings(SettingDictionaryHash, sum)
+}
+
+// 检查记录的词典文件是否与建立索引时的内容相同，返回词典文件的路径
+// 词典被修改后分割出的词元与索引中的不一致，因此拒绝使用该索引
+// 记录校验和之前建立的索引无法检查，记录当前的校验和
+func (env *WiserEnv) checkDictionary() (string, error) {
+	path, err := env.Store.GetSettings(SettingDictionary)
+	if err != nil {
+		return "", err
+	}
+	want, err := env.Store.GetSettings(SettingDictionaryHash)
+	if err != nil {
+		return "", err
+	}
+	sum, err := DictionaryChecksum(path)
+	if err != nil {
+		return "", err
+	}
+	if want == "" {
+		return path, env.Store.ReplaceSettings(SettingDictionaryHash, sum)
+	}
+	if sum != want {
+		return "", fmt.Errorf("dictionary %s has changed since the index was built", path)
+	}
+	return path, nil
+}
+
+// 两个路径是否指向同一个文件，其中一个为空时只有两者都为空才相同
+func sameFile(a, b string) bool {
+	if a == "" || b == "" {
+		return a == b
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return absA == absB
+}
+
+// 将 delta 加到记录在存储器中的文档总长度上
+// 文档的平均长度由文档总长度和文档数计算得出，供 BM25 等方法计算得分时使用
+func (env *WiserEnv) addTotalTokenCount(delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	value, err := env.Store.GetSettings(SettingTotalTokenCount)
+	if err != nil {
+		return err
+	}
+	total := 0
+	if value != "" {
+		total, err = strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+	}
+	return env.Store.ReplaceSettings(SettingTotalTokenCount, strconv.Itoa(total+delta))
+}
+
+// 将 JSON 格式的倒排列表改写为二进制格式
+// 没有压缩的索引改写为可变字节编码，改写完成后将压缩方法记录为 vbyte；
+// 使用 Golomb 编码的索引中的 JSON 改写为 Golomb 编码，压缩方法不变。
+// 改写中途中断时，重新执行即可，已改写的倒排列表不会重复改写。
+// 返回改写的倒排列表数
+func (env *WiserEnv) MigratePostings() (int, error) {
+	err := env.syncSettings()
+	if err != nil {
+		return 0, err
+	}
+	ids, err := env.Store.GetTokenIDs()
+	if err != nil {
+		return 0, err
+	}
+	if !env.Compress.CompressGolomb {
+		env.Compress = CompressMethod{CompressVByte: true}
+	}
+
+	var n int
+	for _, id := range ids {
+		docsCount, buf, err := env.Store.GetPostings(id)
+		if err != nil {
+			return n, err
+		}
+		// 二进制格式都以文件头开始
+		if buf == nil || hasPostingsHeader(buf) {
+			continue
+		}
+		postings, err := decodePostingsNone(buf)
+		if err != nil {
+			return n, fmt.Errorf("failed to decode postings of token %d: %w", id, err)
+		}
+		buf, err = env.EncodePostings(postings)
+		if err != nil {
+			return n, err
+		}
+		err = env.Store.UpdatePostings(id, docsCount, postings.MaxTermFrequency(), buf)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, env.Store.ReplaceSettings(SettingCompressMethod, env.Compress.String())
+}
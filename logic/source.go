@@ -0,0 +1,420 @@
+package logic
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/read-talk/wiser/util"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 文档来源的格式
+const (
+	SourceJSONLines = "jsonl" // 每行一个 JSON 对象
+	SourceCSV       = "csv"   // 第一行为列名的 CSV 文件
+	SourceTSV       = "tsv"   // 以制表符分隔的 CSV 文件
+	SourceDirectory = "dir"   // 目录中的 .txt 和 .md 文件
+	SourceHTML      = "html"  // HTML 文件，或目录中的 HTML 文件
+)
+
+// 默认的标题和正文的字段名
+const (
+	DefaultTitleKey = "title"
+	DefaultBodyKey  = "body"
+)
+
+// 从来源中读取的文档
+type Document struct {
+	Title    string            // 文档标题
+	Body     string            // 文档正文
+	Metadata map[string]string // 文档的元数据，可以为空
+}
+
+// 文档的来源，依次返回要添加到索引中的文档
+type DocumentSource interface {
+	// 返回下一个文档，没有更多的文档时返回 io.EOF
+	Next() (*Document, error)
+	// 释放来源占用的资源
+	Close() error
+}
+
+// 将来源中的文档添加到索引中
+// 标题或正文为空的文档会被跳过，正文没有变化的文档不计入导入的文档数
+// m 最多导入的文档数
+func (env *WiserEnv) LoadDocuments(src DocumentSource, m int) error {
+	var cnt int
+	for cnt < m {
+		doc, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if doc.Title == "" || doc.Body == "" {
+			continue
+		}
+		changed, err := env.addDocument(doc.Title, doc.Body)
+		if err != nil {
+			fmt.Println("add document failed: ", err)
+			return err
+		}
+		if len(doc.Metadata) > 0 {
+			id, err := env.liveDocumentID(doc.Title)
+			if err != nil {
+				return err
+			}
+			err = env.updateDocumentMetadata(id, doc.Metadata)
+			if err != nil {
+				return err
+			}
+		}
+		if changed {
+			cnt++
+		}
+	}
+	// 所有文档都处理完了，将缓冲区中的倒排索引写入存储器
+	return env.AddDocument("", "")
+}
+
+// 打开文档来源
+// path 文件或目录的路径，文件可以是 bzip2 或 gzip 压缩的文件，为 - 时从标准输入读取
+// format 来源的格式，为空时根据路径判断
+// titleKey bodyKey 标题和正文的字段名或列名，为空时使用默认值
+func OpenDocumentSource(path, format, titleKey, bodyKey string) (DocumentSource, error) {
+	if format == "" {
+		var err error
+		format, err = detectSourceFormat(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch format {
+	case SourceDirectory:
+		return NewDirectorySource(path)
+	case SourceHTML:
+		return NewHTMLSource(path)
+	case SourceJSONLines, SourceCSV, SourceTSV:
+	default:
+		return nil, fmt.Errorf("unknown source format: %s", format)
+	}
+	f, err := util.OpenInput(path)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case SourceJSONLines:
+		return NewJSONLinesSource(f, titleKey, bodyKey), nil
+	case SourceTSV:
+		return NewCSVSource(f, '\t', titleKey, bodyKey), nil
+	default:
+		return NewCSVSource(f, ',', titleKey, bodyKey), nil
+	}
+}
+
+// 根据路径判断来源的格式
+func detectSourceFormat(path string) (string, error) {
+	if path != "-" {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		if info.IsDir() {
+			return SourceDirectory, nil
+		}
+	}
+	name := strings.ToLower(path)
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".bz2")
+	switch filepath.Ext(name) {
+	case ".jsonl", ".ndjson", ".json":
+		return SourceJSONLines, nil
+	case ".csv":
+		return SourceCSV, nil
+	case ".tsv", ".tab":
+		return SourceTSV, nil
+	case ".html", ".htm", ".xhtml":
+		return SourceHTML, nil
+	}
+	return "", fmt.Errorf("unknown format of %s", path)
+}
+
+// 关闭 r，r 不需要关闭时什么也不做
+func closeReader(r io.Reader) error {
+	if c, ok := r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// 从 JSON Lines 中读取文档的来源，每行一个 JSON 对象
+type JSONLinesSource struct {
+	TitleKey string // 标题的字段名
+	BodyKey  string // 正文的字段名
+
+	r       io.Reader
+	decoder *json.Decoder
+	line    int // 已读取的对象数
+}
+
+// 创建从 JSON Lines 中读取文档的来源
+// titleKey bodyKey 标题和正文的字段名，为空时使用 title 和 body
+func NewJSONLinesSource(r io.Reader, titleKey, bodyKey string) *JSONLinesSource {
+	if titleKey == "" {
+		titleKey = DefaultTitleKey
+	}
+	if bodyKey == "" {
+		bodyKey = DefaultBodyKey
+	}
+	return &JSONLinesSource{TitleKey: titleKey, BodyKey: bodyKey, r: r, decoder: json.NewDecoder(r)}
+}
+
+func (s *JSONLinesSource) Next() (*Document, error) {
+	var record map[string]interface{}
+	err := s.decoder.Decode(&record)
+	if err != nil {
+		if err != io.EOF {
+			err = fmt.Errorf("invalid json after record %d: %v", s.line, err)
+		}
+		return nil, err
+	}
+	s.line++
+	title, err := s.field(record, s.TitleKey)
+	if err != nil {
+		return nil, err
+	}
+	body, err := s.field(record, s.BodyKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{Title: title, Body: body}, nil
+}
+
+// 获取字符串类型的字段，没有该字段时返回空字符串
+func (s *JSONLinesSource) field(record map[string]interface{}, key string) (string, error) {
+	switch v := record[key].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	default:
+		return "", fmt.Errorf("field %s of record %d is not a string", key, s.line)
+	}
+}
+
+func (s *JSONLinesSource) Close() error {
+	return closeReader(s.r)
+}
+
+// 从 CSV 或 TSV 中读取文档的来源，第一行为列名
+type CSVSource struct {
+	TitleColumn string // 标题的列名
+	BodyColumn  string // 正文的列名
+
+	r      io.Reader
+	reader *csv.Reader
+	title  int // 标题所在的列，读取列名之前为 -1
+	body   int // 正文所在的列
+}
+
+// 创建从 CSV 或 TSV 中读取文档的来源
+// comma 列的分隔符，TSV 为 '\t'
+// titleColumn bodyColumn 标题和正文的列名，为空时使用 title 和 body
+func NewCSVSource(r io.Reader, comma rune, titleColumn, bodyColumn string) *CSVSource {
+	if titleColumn == "" {
+		titleColumn = DefaultTitleKey
+	}
+	if bodyColumn == "" {
+		bodyColumn = DefaultBodyKey
+	}
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	// TSV 中一般不使用引号，出现在字段中间的引号按原样读取
+	reader.LazyQuotes = comma == '\t'
+	return &CSVSource{TitleColumn: titleColumn, BodyColumn: bodyColumn, r: r, reader: reader, title: -1}
+}
+
+func (s *CSVSource) Next() (*Document, error) {
+	if s.title < 0 {
+		err := s.readHeader()
+		if err != nil {
+			return nil, err
+		}
+	}
+	record, err := s.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	return &Document{Title: record[s.title], Body: record[s.body]}, nil
+}
+
+// 读取第一行的列名，确定标题和正文所在的列
+func (s *CSVSource) readHeader() error {
+	header, err := s.reader.Read()
+	if err != nil {
+		return err
+	}
+	s.title, s.body = -1, -1
+	for i, name := range header {
+		switch strings.TrimSpace(name) {
+		case s.TitleColumn:
+			s.title = i
+		case s.BodyColumn:
+			s.body = i
+		}
+	}
+	if s.title < 0 {
+		return fmt.Errorf("column %s not found", s.TitleColumn)
+	}
+	if s.body < 0 {
+		s.title = -1
+		return fmt.Errorf("column %s not found", s.BodyColumn)
+	}
+	return nil
+}
+
+func (s *CSVSource) Close() error {
+	return closeReader(s.r)
+}
+
+// 读取目录中的 .txt 和 .md 文件的来源，包括子目录中的文件
+// Markdown 文件以第一个标题作为文档标题，其他文件以去除扩展名的相对路径作为文档标题
+// 标题与之前读取的文件相同时改用相对路径，以免标题相同的文档相互覆盖
+type DirectorySource struct {
+	dir    string
+	files  []string   // 尚未读取的文件的路径
+	titles usedTitles // 已读取的文件的标题
+}
+
+// 创建读取目录中的文件的来源，以 . 开头的文件和目录会被跳过
+func NewDirectorySource(dir string) (*DirectorySource, error) {
+	files, err := walkFiles(dir, isTextFile)
+	if err != nil {
+		return nil, err
+	}
+	return &DirectorySource{dir: dir, files: files, titles: usedTitles{}}, nil
+}
+
+// 返回目录及其子目录中满足 match 的文件的路径，以 . 开头的文件和目录会被跳过
+func walkFiles(dir string, match func(path string) bool) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() && match(path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// 是否是要导入的文本文件
+func isTextFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".txt", ".md", ".markdown":
+		return true
+	}
+	return false
+}
+
+func (s *DirectorySource) Next() (*Document, error) {
+	if len(s.files) == 0 {
+		return nil, io.EOF
+	}
+	path := s.files[0]
+	s.files = s.files[1:]
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	body := string(data)
+	title := ""
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".md" || ext == ".markdown" {
+		title = markdownTitle(body)
+	}
+	title, err = s.titles.pick(title, s.dir, path)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{Title: title, Body: body}, nil
+}
+
+// 以文件相对于 dir 的路径去除扩展名后作为文档标题
+func fileTitle(dir, path string) (string, error) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel))), nil
+}
+
+// 同一次导入中已使用的文档标题
+// 文档以标题为键，标题相同的文档会覆盖之前的文档
+type usedTitles map[string]bool
+
+// 为 dir 中的文件 path 选择未使用的标题，并将其记为已使用
+// 依次尝试 title、去除扩展名的相对路径和带扩展名的相对路径，title 可以为空
+func (u usedTitles) pick(title, dir, path string) (string, error) {
+	short, err := fileTitle(dir, path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range []string{title, short} {
+		if c != "" && !u[c] {
+			u[c] = true
+			return c, nil
+		}
+	}
+	rel = filepath.ToSlash(rel)
+	u[rel] = true
+	return rel, nil
+}
+
+// 返回 Markdown 中的第一个标题，没有标题时返回空字符串
+func markdownTitle(text string) string {
+	inCode := false
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		// 跳过代码块中以 # 开头的行
+		if strings.HasPrefix(line, "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode || !strings.HasPrefix(line, "#") {
+			continue
+		}
+		heading := strings.TrimLeft(line, "#")
+		// # 之后必须有空格，最多 6 级
+		if len(line)-len(heading) > 6 || heading != "" && heading[0] != ' ' && heading[0] != '\t' {
+			continue
+		}
+		heading = strings.TrimSpace(strings.TrimRight(strings.TrimSpace(heading), "#"))
+		if heading != "" {
+			return heading
+		}
+	}
+	return ""
+}
+
+func (s *DirectorySource) Close() error {
+	s.files = nil
+	return nil
+}
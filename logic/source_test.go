@@ -0,0 +1,194 @@
+package logic
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 读取来源中的所有文档，返回标题和正文
+func readSource(t *testing.T, src DocumentSource) [][2]string {
+	t.Helper()
+	var ret [][2]string
+	for {
+		doc, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret = append(ret, [2]string{doc.Title, doc.Body})
+	}
+	return ret
+}
+
+func TestJSONLinesSource(t *testing.T) {
+	r := strings.NewReader(`{"name": "东京", "text": "东京是日本的首都", "id": 1}
+{"name": "京都", "text": "京都是\n日本的古都"}
+
+{"name": "大阪"}
+`)
+	got := readSource(t, NewJSONLinesSource(r, "name", "text"))
+	want := [][2]string{{"东京", "东京是日本的首都"}, {"京都", "京都是\n日本的古都"}, {"大阪", ""}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("documents = %v, want %v", got, want)
+	}
+
+	src := NewJSONLinesSource(strings.NewReader(`{"title": 1, "body": "x"}`), "", "")
+	if _, err := src.Next(); err == nil {
+		t.Errorf("no error for title of number")
+	}
+	src = NewJSONLinesSource(strings.NewReader(`{"title": "a", "body": "x"}
+{"title": `), "", "")
+	src.Next()
+	if _, err := src.Next(); err == nil || err == io.EOF {
+		t.Errorf("Next of invalid json = %v", err)
+	}
+}
+
+func TestCSVSource(t *testing.T) {
+	r := strings.NewReader("id,body,title\n1,东京是日本的首都,东京\n2,\"京都是\n日本的\"\"古都\"\"\",京都\n")
+	got := readSource(t, NewCSVSource(r, ',', "", ""))
+	want := [][2]string{{"东京", "东京是日本的首都"}, {"京都", "京都是\n日本的\"古都\""}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("csv documents = %v, want %v", got, want)
+	}
+
+	r = strings.NewReader("name\ttext\n东京\t东京是日本的\"首都\"\n")
+	got = readSource(t, NewCSVSource(r, '\t', "name", "text"))
+	want = [][2]string{{"东京", "东京是日本的\"首都\""}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tsv documents = %v, want %v", got, want)
+	}
+
+	src := NewCSVSource(strings.NewReader("title,text\na,b\n"), ',', "", "")
+	if _, err := src.Next(); err == nil || !strings.Contains(err.Error(), "body") {
+		t.Errorf("Next without body column = %v", err)
+	}
+}
+
+func TestDirectorySource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wiser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	files := map[string]string{
+		"东京.txt":          "# 不是标题\n东京是日本的首都",
+		"sub/京都.md":       "```\n# 代码\n```\n#标签\n## 京都 ##\n京都是日本的古都",
+		"sub/大阪.markdown": "大阪是日本的城市",
+		"image.png":       "",
+		".git/a.txt":      "隐藏的文件",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	src, err := NewDirectorySource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, doc := range readSource(t, src) {
+		titles = append(titles, doc[0])
+	}
+	want := []string{"京都", "sub/大阪", "东京"}
+	if !reflect.DeepEqual(titles, want) {
+		t.Errorf("titles = %v, want %v", titles, want)
+	}
+}
+
+func TestDirectorySourceDuplicateTitles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wiser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	files := map[string]string{
+		"a/README.md":  "# 简介\n东京是日本的首都",
+		"b/README.md":  "# 简介\n京都是日本的古都",
+		"b/README.txt": "大阪是日本的城市",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 标题相同的文件改用相对路径作为标题，不会相互覆盖
+	env := newTestEnv()
+	src, err := NewDirectorySource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.LoadDocuments(src, 100); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := env.Store.GetDocumentCount(); n != 3 {
+		t.Errorf("GetDocumentCount = %d, want 3", n)
+	}
+	for _, title := range []string{"简介", "b/README", "b/README.txt"} {
+		if id, _ := env.Store.GetDocumentID(title); id == 0 {
+			t.Errorf("document %s not found", title)
+		}
+	}
+}
+
+func TestLoadDocuments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wiser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "docs.jsonl")
+	data := `{"title": "东京", "body": "东京是日本的首都"}
+{"title": "空", "body": ""}
+{"title": "京都", "body": "京都是日本的古都"}
+{"title": "大阪", "body": "大阪是日本的城市"}
+`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	env := newTestEnv()
+	src, err := OpenDocumentSource(path, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	// 跳过的文档不计入导入的文档数
+	if err := env.LoadDocuments(src, 2); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := env.Store.GetDocumentCount(); n != 2 {
+		t.Errorf("GetDocumentCount = %d, want 2", n)
+	}
+	want, _ := env.Store.GetDocumentID("京都")
+	if ids := searchIDs(t, env, "古都"); !reflect.DeepEqual(ids, []int{want}) {
+		t.Errorf("search 古都 = %v, want [%d]", ids, want)
+	}
+
+	if _, err := OpenDocumentSource(filepath.Join(dir, "docs.xml"), "", "", ""); err == nil {
+		t.Errorf("no error for unknown format")
+	}
+	if src, err := OpenDocumentSource(dir, "", "", ""); err != nil {
+		t.Errorf("OpenDocumentSource of directory: %v", err)
+	} else if _, ok := src.(*DirectorySource); !ok {
+		t.Errorf("source of directory = %T", src)
+	}
+}
@@ -0,0 +1,194 @@
+package logic
+
+import "math"
+
+// 使用 Block-Max WAND 进行动态剪枝的 OR 游标
+// 检索结果已经保留了 k 个结果时，得分不超过其中最低得分的文档不可能再进入检索结果。
+// 将子节点按当前的文档编号排序，依次累加各子节点的得分上限，超过最低得分的位置称为枢轴（pivot），
+// 比枢轴的文档编号小的文档只能与前面的子节点匹配，得分不可能超过最低得分，因此可以直接跳过。
+// 找到枢轴后，再用各子节点在块中的得分上限进行检查，不超过最低得分时跳过整个块。
+type wandCursor struct {
+	children []queryCursor
+	live     []queryCursor // 尚未遍历完的子节点，按当前的文档编号排序
+	results  *topKResults  // 检索结果，从中获取最低得分
+	current  int           // 当前的文档编号
+	pruned   bool          // 是否跳过了可能匹配的文档
+	done     bool
+}
+
+// 新建 WAND 游标，游标指向第一个可能进入检索结果的文档
+func newWandCursor(children []queryCursor, results *topKResults) (*wandCursor, error) {
+	c := &wandCursor{children: children, results: results}
+	return c, c.match()
+}
+
+func (c *wandCursor) Done() bool {
+	return c.done
+}
+
+func (c *wandCursor) DocumentID() int {
+	return c.current
+}
+
+func (c *wandCursor) Next() error {
+	if c.done {
+		return nil
+	}
+	for _, child := range c.children {
+		if !child.Done() && child.DocumentID() == c.current {
+			err := child.Next()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return c.match()
+}
+
+func (c *wandCursor) SkipTo(documentID int) error {
+	if c.done || c.current >= documentID {
+		return nil
+	}
+	for _, child := range c.children {
+		err := child.SkipTo(documentID)
+		if err != nil {
+			return err
+		}
+	}
+	return c.match()
+}
+
+// 得分是与当前文档匹配的子节点的得分之和
+func (c *wandCursor) Score() (float64, error) {
+	var score float64
+	for _, child := range c.children {
+		if !child.Done() && child.DocumentID() == c.current {
+			s, err := child.Score()
+			if err != nil {
+				return 0, err
+			}
+			score += s
+		}
+	}
+	return score, nil
+}
+
+func (c *wandCursor) MaxScore() float64 {
+	return sumMaxScore(c.children)
+}
+
+func (c *wandCursor) BlockMaxScore(documentID int) (float64, int) {
+	return sumBlockMaxScore(c.children, documentID)
+}
+
+// 得分的上限是否可能超过检索结果中的最低得分
+// 为浮点数的计算误差留出余量
+func exceedsThreshold(maxScore, threshold float64) bool {
+	return maxScore*(1+1e-9) > threshold
+}
+
+// 为 OR 节点打开 WAND 游标
+func (env *WiserEnv) openWandCursor(node *QueryNode, sc *scoreContext, results *topKResults) (*wandCursor, error) {
+	children, err := env.openOrChildren(node, sc)
+	if err != nil {
+		return nil, err
+	}
+	return newWandCursor(children, results)
+}
+
+// 从当前的位置开始，找到第一个可能进入检索结果的文档
+func (c *wandCursor) match() error {
+	for {
+		live := c.live[:0]
+		for _, child := range c.children {
+			if !child.Done() {
+				live = append(live, child)
+			}
+		}
+		c.live = live
+		if len(live) == 0 {
+			c.done = true
+			return nil
+		}
+		// 子节点不多，并且每次只有少数子节点移动，使用插入排序
+		for i := 1; i < len(live); i++ {
+			for j := i; j > 0 && live[j].DocumentID() < live[j-1].DocumentID(); j-- {
+				live[j], live[j-1] = live[j-1], live[j]
+			}
+		}
+		threshold, full := c.results.threshold()
+		if !full {
+			// 检索结果还没有保留 k 个结果时，所有文档都可能进入检索结果
+			c.current = live[0].DocumentID()
+			return nil
+		}
+
+		// 寻找枢轴
+		pivot := -1
+		var sum float64
+		for i, child := range live {
+			sum += child.MaxScore()
+			if exceedsThreshold(sum, threshold) {
+				pivot = i
+				break
+			}
+		}
+		if pivot < 0 {
+			// 剩下的文档都不可能进入检索结果
+			c.pruned = true
+			c.done = true
+			return nil
+		}
+		pivotID := live[pivot].DocumentID()
+		// 文档编号与枢轴相同的子节点也参与计算
+		for pivot+1 < len(live) && live[pivot+1].DocumentID() == pivotID {
+			pivot++
+		}
+
+		// 用块中的得分上限检查从枢轴开始的范围
+		var blockSum float64
+		last := math.MaxInt32
+		for _, child := range live[:pivot+1] {
+			s, l := child.BlockMaxScore(pivotID)
+			blockSum += s
+			if l < last {
+				last = l
+			}
+		}
+		if !exceedsThreshold(blockSum, threshold) {
+			// 跳过整个范围，但不能越过后面的子节点的文档
+			c.pruned = true
+			next := last + 1
+			if pivot+1 < len(live) && live[pivot+1].DocumentID() < next {
+				next = live[pivot+1].DocumentID()
+			} else if last == math.MaxInt32 {
+				c.done = true
+				return nil
+			}
+			for _, child := range live[:pivot+1] {
+				err := child.SkipTo(next)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if live[0].DocumentID() == pivotID {
+			c.current = pivotID
+			return nil
+		}
+		// 将枢轴前面的子节点中得分上限最大的一个移动到枢轴
+		best := 0
+		for i := 1; i < pivot && live[i].DocumentID() < pivotID; i++ {
+			if live[i].MaxScore() > live[best].MaxScore() {
+				best = i
+			}
+		}
+		err := live[best].SkipTo(pivotID)
+		if err != nil {
+			return err
+		}
+		c.pruned = true
+	}
+}
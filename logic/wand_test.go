@@ -0,0 +1,113 @@
+package logic
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// 新建随机生成的文档组成的索引
+// 文档由随机的汉字和若干地名组成，越靠后的地名越少见，常见的地名出现在多个块中
+func newRandomEnv(t testing.TB, n int) *WiserEnv {
+	env := newTestEnv()
+	env.Compress = CompressMethod{CompressVByte: true}
+	words := []string{"东京", "京都", "大阪", "奈良", "札幌", "横滨", "神户", "福冈"}
+	r := rand.New(rand.NewSource(1))
+	var docs []string
+	for i := 0; i < n; i++ {
+		var body []rune
+		for j := r.Intn(20) + 5; j > 0; j-- {
+			body = append(body, rune(0x4e00+r.Intn(200)))
+			if r.Intn(4) == 0 {
+				body = append(body, []rune(words[int(float64(len(words))*r.Float64()*r.Float64())])...)
+			}
+		}
+		docs = append(docs, string(rune(0x4e00+i)), string(body))
+	}
+	addDocuments(t, env, docs...)
+	return env
+}
+
+func TestWand(t *testing.T) {
+	env := newRandomEnv(t, 2000)
+	queries := []string{
+		"东京 OR 京都",
+		"东京 OR 福冈 OR 神户",
+		"奈良 OR (东京 京都) OR \"京都大阪\"",
+		"(札幌 -东京) OR 横滨",
+	}
+	for _, scorer := range []Scorer{TfIdfScorer{}, NewBM25Scorer()} {
+		pruned := false
+		for _, q := range queries {
+			for _, limit := range []int{1, 10, 100} {
+				want, wantStats, err := env.Search(context.Background(), q,
+					&SearchOptions{Scorer: scorer, Limit: limit, ExactTotalHits: true})
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, stats, err := env.Search(context.Background(), q,
+					&SearchOptions{Scorer: scorer, Limit: limit})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%T %q limit %d: pruned results differ\ngot  %v\nwant %v", scorer, q, limit, got, want)
+				}
+				if !wantStats.TotalHitsExact || stats.TotalHits > wantStats.TotalHits {
+					t.Errorf("%T %q: TotalHits = %d, exact %d", scorer, q, stats.TotalHits, wantStats.TotalHits)
+				}
+				if !stats.TotalHitsExact {
+					pruned = true
+				}
+			}
+		}
+		if !pruned {
+			t.Errorf("%T: no documents were skipped", scorer)
+		}
+	}
+}
+
+func TestBlockMaxTermFrequency(t *testing.T) {
+	docs := make(map[int][]int)
+	var ids []int
+	for i := 1; i <= 300; i++ {
+		docs[i] = make([]int, i%50+1)
+		ids = append(ids, i)
+	}
+	buf := encodePostingsVByte(makePostings(docs, ids...))
+	blocks, err := decodePostingsBlocks(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, b := range blocks {
+		got = append(got, b.maxTermFrequency)
+	}
+	if want := []int{50, 50, 50}; !reflect.DeepEqual(got, want) {
+		t.Errorf("block max tf = %v, want %v", got, want)
+	}
+	if n := makePostings(docs, 1, 2, 3).MaxTermFrequency(); n != 4 {
+		t.Errorf("MaxTermFrequency = %d, want 4", n)
+	}
+}
+
+func BenchmarkWand(b *testing.B) {
+	env := newRandomEnv(b, 5000)
+	b.ResetTimer()
+	for _, exact := range []bool{true, false} {
+		name := "pruned"
+		if exact {
+			name = "exhaustive"
+		}
+		b.Run(name, func(b *testing.B) {
+			opts := &SearchOptions{Limit: 10, ExactTotalHits: exact}
+			for i := 0; i < b.N; i++ {
+				_, _, err := env.Search(context.Background(), "东京 OR 福冈", opts)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
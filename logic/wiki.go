@@ -0,0 +1,172 @@
+package logic
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// 记录 wiki 页面的信息的元数据的键
+const (
+	MetadataPageID    = "page_id"   // 页面编号
+	MetadataTimestamp = "timestamp" // 最后修订的时间
+)
+
+// 从 wiki 数据中读取页面的文档来源
+// 只返回指定的名字空间中的页面。重定向页面不作为文档返回，而是作为目标页面的标题的别名。
+// 返回的文档的正文已去除标记，需要时将章节标题和链接记录为文档的元数据。
+type WikiSource struct {
+	env     *WiserEnv
+	r       io.Reader
+	decoder *xml.Decoder
+}
+
+// 创建从 r 中读取 wiki 数据的文档来源
+// env 决定导入的名字空间和记录的元数据，重定向页面的别名也写入其中
+func NewWikiSource(env *WiserEnv, r io.Reader) *WikiSource {
+	return &WikiSource{env: env, r: r, decoder: xml.NewDecoder(r)}
+}
+
+func (s *WikiSource) Next() (*Document, error) {
+	for {
+		t, err := s.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		se, ok := t.(xml.StartElement)
+		if !ok || se.Name.Local != "page" {
+			continue
+		}
+		var p Page
+		err = s.decoder.DecodeElement(&p, &se)
+		if err != nil {
+			return nil, err
+		}
+		doc, err := s.env.wikiPageDocument(&p)
+		if err != nil || doc != nil {
+			return doc, err
+		}
+	}
+}
+
+func (s *WikiSource) Close() error {
+	return closeReader(s.r)
+}
+
+// 将 wiki 页面转换为文档
+// 不导入的名字空间中的页面和重定向页面返回 nil
+func (env *WiserEnv) wikiPageDocument(p *Page) (*Document, error) {
+	if !env.importsNamespace(p.NS) {
+		return nil, nil
+	}
+	if p.Redirect != nil && p.Redirect.Title != "" {
+		return nil, env.addRedirect(p.Title, p.Redirect.Title)
+	}
+	// 曾经是重定向页面时，删除其别名
+	target, err := env.Store.GetAliasTarget(p.Title)
+	if err != nil {
+		return nil, err
+	}
+	if target != "" {
+		err = env.Store.ReplaceAlias(p.Title, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 去除标记后正文为空的页面由 LoadDocuments 跳过，也不更新同名文档的元数据
+	plain := StripWikitext(p.Text)
+	metadata := map[string]string{MetadataTimestamp: p.Timestamp}
+	if p.ID != 0 {
+		metadata[MetadataPageID] = strconv.Itoa(p.ID)
+	}
+	if env.RecordWikiFields {
+		metadata[MetadataHeadings] = strings.Join(plain.Headings, "\n")
+		metadata[MetadataLinks] = strings.Join(plain.Links, "\n")
+	}
+	return &Document{Title: p.Title, Body: plain.Text, Metadata: metadata}, nil
+}
+
+// 是否导入该名字空间中的页面
+func (env *WiserEnv) importsNamespace(ns int) bool {
+	if len(env.WikiNamespaces) == 0 {
+		return ns == 0
+	}
+	for _, n := range env.WikiNamespaces {
+		if n == ns {
+			return true
+		}
+	}
+	return false
+}
+
+// 将重定向页面的标题作为目标页面的标题的别名
+// 之前作为文档导入的同名页面会被删除
+// title 重定向页面的标题
+// target 目标页面的标题，可以带有章节名
+func (env *WiserEnv) addRedirect(title, target string) error {
+	if i := strings.Index(target, "#"); i >= 0 {
+		target = target[:i]
+	}
+	target = strings.TrimSpace(target)
+	if target == "" || target == title {
+		return nil
+	}
+	id, err := env.liveDocumentID(title)
+	if err != nil {
+		return err
+	}
+	if id != 0 {
+		err = env.DeleteDocument(id)
+		if err != nil {
+			return err
+		}
+	}
+	return env.Store.ReplaceAlias(title, target)
+}
+
+// 根据标题获取文档编号，标题是别名时返回其指向的文档的编号
+// 文档不存在或已删除时返回 0
+func (env *WiserEnv) GetDocumentIDByTitle(title string) (int, error) {
+	id, err := env.liveDocumentID(title)
+	if err != nil || id != 0 {
+		return id, err
+	}
+	target, err := env.Store.GetAliasTarget(title)
+	if err != nil || target == "" {
+		return 0, err
+	}
+	return env.liveDocumentID(target)
+}
+
+// 根据标题获取未删除的文档的编号，文档不存在或已删除时返回 0
+func (env *WiserEnv) liveDocumentID(title string) (int, error) {
+	id, err := env.Store.GetDocumentID(title)
+	if err != nil || id == 0 {
+		return 0, err
+	}
+	deleted, err := env.Store.IsDocumentDeleted(id)
+	if err != nil || deleted {
+		return 0, err
+	}
+	return id, nil
+}
+
+// 更新文档的元数据，只写入发生了变化的项
+func (env *WiserEnv) updateDocumentMetadata(id int, metadata map[string]string) error {
+	old, err := env.Store.GetDocumentMetadata(id)
+	if err != nil {
+		return err
+	}
+	for k, v := range metadata {
+		if old[k] == v {
+			continue
+		}
+		err = env.Store.UpdateDocumentMetadata(id, k, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
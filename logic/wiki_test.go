@@ -0,0 +1,273 @@
+package logic
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 将页面写入临时的 wiki 数据文件，返回文件的路径
+// pages 依次为每个页面的 <page> 元素中的内容
+func writeWikiDump(t *testing.T, pages ...string) string {
+	dir, err := ioutil.TempDir("", "wiser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	var b strings.Builder
+	b.WriteString(`<mediawiki xmlns="http://www.mediawiki.org/xml/export-0.10/" version="0.10" xml:lang="zh">` + "\n")
+	for _, p := range pages {
+		b.WriteString("<page>" + p + "</page>\n")
+	}
+	b.WriteString("</mediawiki>\n")
+	path := filepath.Join(dir, "dump.xml")
+	if err := ioutil.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// 生成 <page> 元素中的内容
+func wikiPage(title string, ns, id int, redirect, text string) string {
+	s := fmt.Sprintf("<title>%s</title><ns>%d</ns><id>%d</id>", title, ns, id)
+	if redirect != "" {
+		s += fmt.Sprintf(`<redirect title="%s" />`, redirect)
+	}
+	return s + fmt.Sprintf("<revision><id>%d</id><timestamp>2020-01-0%dT00:00:00Z</timestamp><text>%s</text></revision>",
+		id*10, id, text)
+}
+
+func TestLoadWikiDumpNamespaces(t *testing.T) {
+	path := writeWikiDump(t,
+		wikiPage("东京", 0, 1, "", "东京是日本的首都"),
+		wikiPage("Talk:东京", 1, 2, "", "关于东京的讨论"),
+		wikiPage("Template:日本", 10, 3, "", "日本的模板"),
+		wikiPage("京都", 0, 4, "", "京都是日本的古都"))
+
+	env := newTestEnv()
+	if err := env.LoadWikiDump(path, 100); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := env.Store.GetDocumentCount(); n != 2 {
+		t.Errorf("GetDocumentCount = %d, want 2", n)
+	}
+	if id, _ := env.Store.GetDocumentID("Talk:东京"); id != 0 {
+		t.Errorf("talk page indexed")
+	}
+	id, _ := env.Store.GetDocumentID("京都")
+	metadata, _ := env.Store.GetDocumentMetadata(id)
+	if metadata[MetadataPageID] != "4" || metadata[MetadataTimestamp] != "2020-01-04T00:00:00Z" {
+		t.Errorf("metadata = %v", metadata)
+	}
+
+	// 只计算导入的页面
+	env = newTestEnv()
+	if err := env.LoadWikiDump(path, 2); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := env.Store.GetDocumentCount(); n != 2 {
+		t.Errorf("GetDocumentCount with max count 2 = %d, want 2", n)
+	}
+
+	env = newTestEnv()
+	env.WikiNamespaces = []int{1, 10}
+	if err := env.LoadWikiDump(path, 100); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := env.Store.GetDocumentCount(); n != 2 {
+		t.Errorf("GetDocumentCount of namespaces 1 and 10 = %d, want 2", n)
+	}
+	if id, _ := env.Store.GetDocumentID("东京"); id != 0 {
+		t.Errorf("page of main namespace indexed")
+	}
+}
+
+func TestWikiSource(t *testing.T) {
+	path := writeWikiDump(t,
+		wikiPage("东京", 0, 1, "", "'''东京'''是日本的首都"),
+		wikiPage("Talk:东京", 1, 2, "", "关于东京的讨论"),
+		wikiPage("江户", 0, 3, "东京", "#REDIRECT [[东京]]"))
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := newTestEnv()
+	src := NewWikiSource(env, f)
+	defer src.Close()
+
+	// 只返回主名字空间中的普通页面，重定向页面作为别名记录
+	doc, err := src.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Title != "东京" || doc.Body != "东京是日本的首都" || doc.Metadata[MetadataPageID] != "1" {
+		t.Errorf("Next = %+v", doc)
+	}
+	if _, err := src.Next(); err != io.EOF {
+		t.Errorf("Next at end = %v, want io.EOF", err)
+	}
+	if target, _ := env.Store.GetAliasTarget("江户"); target != "东京" {
+		t.Errorf("GetAliasTarget(江户) = %q, want 东京", target)
+	}
+}
+
+func TestLoadWikiDumpUnchanged(t *testing.T) {
+	env := newTestEnv()
+	path := writeWikiDump(t,
+		wikiPage("东京", 0, 1, "", "东京是日本的首都"),
+		wikiPage("京都", 0, 2, "", "京都是日本的古都"))
+	if err := env.LoadWikiDump(path, 100); err != nil {
+		t.Fatal(err)
+	}
+	deleted, _ := env.Store.GetDocumentID("东京")
+	if err := env.DeleteDocument(deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	// 正文为空的页面和正文没有变化的页面都不计入导入的文档数
+	path = writeWikiDump(t,
+		wikiPage("东京", 0, 5, "", "{{日本}}"),
+		wikiPage("京都", 0, 2, "", "京都是日本的古都"),
+		wikiPage("大阪", 0, 3, "", "大阪是日本的商都"),
+		wikiPage("神户", 0, 4, "", "神户是日本的港口"))
+	if err := env.LoadWikiDump(path, 1); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := env.GetDocumentIDByTitle("大阪"); id == 0 {
+		t.Errorf("changed page after unchanged pages not imported")
+	}
+	if id, _ := env.GetDocumentIDByTitle("神户"); id != 0 {
+		t.Errorf("page beyond max count imported")
+	}
+	// 已删除的文档的元数据不被更新
+	if metadata, _ := env.Store.GetDocumentMetadata(deleted); metadata[MetadataPageID] != "1" {
+		t.Errorf("metadata of deleted document = %v", metadata)
+	}
+}
+
+func TestLoadWikiDumpRedirects(t *testing.T) {
+	env := newTestEnv()
+	// 之前作为文档导入的页面变为重定向页面
+	path := writeWikiDump(t,
+		wikiPage("东京", 0, 1, "", "东京是日本的首都"),
+		wikiPage("东京都", 0, 2, "", "东京都的旧页面"))
+	if err := env.LoadWikiDump(path, 100); err != nil {
+		t.Fatal(err)
+	}
+	path = writeWikiDump(t,
+		wikiPage("江户", 0, 3, "东京", "#REDIRECT [[东京]]"),
+		wikiPage("东京", 0, 1, "", "东京是日本的首都"),
+		wikiPage("东京都", 0, 2, "东京#行政", "#重定向 [[东京#行政]]"))
+	if err := env.LoadWikiDump(path, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, _ := env.Store.GetDocumentCount(); n != 1 || env.IndexedCount != 1 {
+		t.Errorf("GetDocumentCount = %d, IndexedCount = %d, want 1", n, env.IndexedCount)
+	}
+	want, _ := env.Store.GetDocumentID("东京")
+	for _, title := range []string{"东京", "江户", "东京都"} {
+		if id, err := env.GetDocumentIDByTitle(title); err != nil || id != want {
+			t.Errorf("GetDocumentIDByTitle(%s) = %d, %v, want %d", title, id, err, want)
+		}
+	}
+	if ids := searchIDs(t, env, "旧页面"); len(ids) != 0 {
+		t.Errorf("redirected page still searchable: %v", ids)
+	}
+	if id, _ := env.GetDocumentIDByTitle("大阪"); id != 0 {
+		t.Errorf("GetDocumentIDByTitle of missing title = %d", id)
+	}
+
+	// 重定向页面变回普通页面
+	path = writeWikiDump(t, wikiPage("江户", 0, 3, "", "江户是东京的旧称"))
+	if err := env.LoadWikiDump(path, 100); err != nil {
+		t.Fatal(err)
+	}
+	if target, _ := env.Store.GetAliasTarget("江户"); target != "" {
+		t.Errorf("alias of normal page = %q", target)
+	}
+	if id, _ := env.GetDocumentIDByTitle("江户"); id == want || id == 0 {
+		t.Errorf("GetDocumentIDByTitle(江户) = %d", id)
+	}
+
+	// 可以用别名删除文档
+	if err := env.DeleteDocumentByTitle("东京都"); err != nil {
+		t.Fatal(err)
+	}
+	if deleted, _ := env.Store.IsDocumentDeleted(want); !deleted {
+		t.Errorf("document not deleted by alias")
+	}
+}
+
+// 检查导入的文档
+func checkWikiDocuments(t *testing.T, env *WiserEnv, titles ...string) {
+	t.Helper()
+	if n, _ := env.Store.GetDocumentCount(); n != len(titles) {
+		t.Errorf("GetDocumentCount = %d, want %d", n, len(titles))
+	}
+	for _, title := range titles {
+		if id, _ := env.Store.GetDocumentID(title); id == 0 {
+			t.Errorf("%s not indexed", title)
+		}
+	}
+}
+
+func TestLoadCompressedWikiDump(t *testing.T) {
+	path := writeWikiDump(t,
+		wikiPage("东京", 0, 1, "", "东京是日本的首都"),
+		wikiPage("京都", 0, 2, "", "京都是日本的古都"))
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有扩展名时根据魔数判断压缩格式
+	for _, name := range []string{"dump.xml.gz", "dump"} {
+		gzPath := filepath.Join(filepath.Dir(path), name)
+		f, err := os.Create(gzPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := gzip.NewWriter(f)
+		w.Write(data)
+		w.Close()
+		f.Close()
+
+		env := newTestEnv()
+		if err := env.LoadWikiDump(gzPath, 100); err != nil {
+			t.Fatalf("LoadWikiDump(%s): %v", name, err)
+		}
+		checkWikiDocuments(t, env, "东京", "京都")
+	}
+
+	env := newTestEnv()
+	if err := env.LoadWikiDump("testdata/dump.xml.bz2", 100); err != nil {
+		t.Fatal(err)
+	}
+	checkWikiDocuments(t, env, "东京", "京都")
+	if ids := searchIDs(t, env, "古都"); len(ids) != 1 {
+		t.Errorf("search 古都 = %v", ids)
+	}
+}
+
+func TestLoadWikiDumpFromStdin(t *testing.T) {
+	path := writeWikiDump(t, wikiPage("东京", 0, 1, "", "东京是日本的首都"))
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stdin := os.Stdin
+	os.Stdin = f
+	defer func() { os.Stdin = stdin }()
+
+	env := newTestEnv()
+	if err := env.LoadWikiDump("-", 100); err != nil {
+		t.Fatal(err)
+	}
+	checkWikiDocuments(t, env, "东京")
+}
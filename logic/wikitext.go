@@ -0,0 +1,208 @@
+package logic
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// 记录 wiki 页面中的章节标题和链接的元数据的键，多个值之间以换行分隔
+const (
+	MetadataHeadings = "headings" // 章节标题
+	MetadataLinks    = "links"    // 链接到的页面的标题
+)
+
+// 从 wikitext 中提取的纯文本
+type WikiPlainText struct {
+	Text     string   // 纯文本
+	Headings []string // 章节标题
+	Links    []string // 链接到的页面的标题，按出现的顺序排列，不重复
+
+	seen map[string]bool // 已经记录过的链接
+}
+
+var (
+	wikiCommentRegexp      = regexp.MustCompile(`(?s)<!--.*?-->`)
+	wikiTagRegexp          = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	wikiExternalLinkRegexp = regexp.MustCompile(`\[(?:https?:)?//[^\s\]]*\s*([^\]]*)\]`)
+	wikiMagicWordRegexp    = regexp.MustCompile(`__[A-Z]+__`)
+	wikiHeadingRegexp      = regexp.MustCompile(`^(=+)\s*(.*?)\s*=+\s*$`)
+	wikiListRegexp         = regexp.MustCompile(`^[*#:;]+\s*`)
+	// 连同内容一起去除的标签
+	wikiDroppedTagRegexps = func() []*regexp.Regexp {
+		var ret []*regexp.Regexp
+		for _, tag := range []string{"ref", "math", "gallery", "timeline", "score", "syntaxhighlight", "source"} {
+			ret = append(ret,
+				regexp.MustCompile(`(?is)<`+tag+`\b[^>]*/>`),
+				regexp.MustCompile(`(?is)<`+tag+`\b[^>]*>.*?</`+tag+`\s*>`))
+		}
+		return ret
+	}()
+)
+
+// 链接到这些名字空间的页面时，不是正文中的链接，连同链接文字一起去除
+var wikiDroppedLinkPrefixes = []string{
+	"file:", "image:", "media:", "category:", "文件:", "檔案:", "图像:", "圖像:", "分类:", "分類:",
+}
+
+// 将 wikitext 转换为纯文本
+// 保留链接文字和章节标题，去除模板、表格、引用、注释和其他标记，并解码 HTML 实体
+func StripWikitext(text string) *WikiPlainText {
+	ret := &WikiPlainText{}
+	text = wikiCommentRegexp.ReplaceAllString(text, "")
+	for _, re := range wikiDroppedTagRegexps {
+		text = re.ReplaceAllString(text, "")
+	}
+	text = removeNested(text, "{{", "}}")
+	text = removeNested(text, "{|", "|}")
+	text = ret.replaceLinks(text)
+	text = wikiTagRegexp.ReplaceAllString(text, "")
+	text = wikiExternalLinkRegexp.ReplaceAllString(text, "$1")
+	text = wikiMagicWordRegexp.ReplaceAllString(text, "")
+	text = strings.NewReplacer("'''", "", "''", "").Replace(text)
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if m := wikiHeadingRegexp.FindStringSubmatch(line); m != nil {
+			line = html.UnescapeString(m[2])
+			if line != "" {
+				ret.Headings = append(ret.Headings, line)
+			}
+		} else if strings.HasPrefix(line, "----") {
+			continue
+		} else {
+			line = html.UnescapeString(wikiListRegexp.ReplaceAllString(line, ""))
+		}
+		// 连续的空行只保留一个
+		if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	ret.Text = strings.TrimSpace(strings.Join(lines, "\n"))
+	return ret
+}
+
+// 去除以 open 开始、以 close 结束的部分，可以嵌套
+// 没有对应的 close 时，保留该 open 及其后的文字，其后的文字中闭合的部分仍会被去除
+func removeNested(text, open, close string) string {
+	var b strings.Builder
+	depth := 0
+	start := 0 // 最外层的 open 的位置
+	for i := 0; i < len(text); {
+		switch {
+		case strings.HasPrefix(text[i:], open):
+			if depth == 0 {
+				start = i
+			}
+			depth++
+			i += len(open)
+		case depth > 0 && strings.HasPrefix(text[i:], close):
+			depth--
+			i += len(close)
+		default:
+			if depth == 0 {
+				b.WriteByte(text[i])
+			}
+			i++
+		}
+	}
+	if depth > 0 {
+		b.WriteString(open)
+		b.WriteString(removeNested(text[start+len(open):], open, close))
+	}
+	return b.String()
+}
+
+// 将 [[目标|文字]] 形式的内部链接替换为链接文字，并记录链接到的页面
+// 链接文字中可以嵌套链接，例如图片的说明文字
+func (w *WikiPlainText) replaceLinks(text string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(text, "[[")
+		if start < 0 {
+			b.WriteString(text)
+			return b.String()
+		}
+		b.WriteString(text[:start])
+		// 寻找对应的 ]]
+		depth := 0
+		end := -1
+		for i := start; i+1 < len(text); i++ {
+			if text[i] == '[' && text[i+1] == '[' {
+				depth++
+				i++
+			} else if text[i] == ']' && text[i+1] == ']' {
+				depth--
+				i++
+				if depth == 0 {
+					end = i + 1
+					break
+				}
+			}
+		}
+		if end < 0 {
+			// 没有闭合的链接，去除 [[ 之后继续处理
+			text = text[start+2:]
+			continue
+		}
+		b.WriteString(w.linkText(text[start+2 : end-2]))
+		text = text[end:]
+	}
+}
+
+// 返回内部链接的链接文字
+// link [[ 和 ]] 之间的内容
+func (w *WikiPlainText) linkText(link string) string {
+	target, label := link, ""
+	if i := strings.Index(link, "|"); i >= 0 {
+		target, label = link[:i], link[i+1:]
+	}
+	target = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(target), ":"))
+	lower := strings.ToLower(target)
+	for _, prefix := range wikiDroppedLinkPrefixes {
+		if strings.HasPrefix(lower, prefix) {
+			return ""
+		}
+	}
+	// 链接到其他语言的页面，例如 [[en:Mathematics]]
+	if i := strings.Index(target, ":"); i > 0 && i <= 3 && lower[:i] == target[:i] && isLanguageCode(lower[:i]) {
+		return ""
+	}
+	if i := strings.Index(target, "#"); i >= 0 {
+		target = strings.TrimSpace(target[:i])
+	}
+	if label == "" {
+		label = strings.TrimPrefix(link, "#")
+	}
+	if target != "" {
+		w.addLink(target)
+	}
+	return w.replaceLinks(label)
+}
+
+// 记录链接到的页面，已经记录过的页面不再记录
+func (w *WikiPlainText) addLink(target string) {
+	if w.seen[target] {
+		return
+	}
+	if w.seen == nil {
+		w.seen = make(map[string]bool)
+	}
+	w.seen[target] = true
+	w.Links = append(w.Links, target)
+}
+
+// 是否是由 2 到 3 个小写字母组成的语言代码
+func isLanguageCode(s string) bool {
+	if len(s) < 2 || len(s) > 3 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 'a' || s[i] > 'z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package logic
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStripWikitext(t *testing.T) {
+	text := `{{Infobox|name=数学|image=[[File:a.png]]}}
+'''数学'''是研究[[数量]]、[[结构 (数学)|结构]]的学科<ref name="a">{{Cite web|title=x}}</ref>。<!-- 注释 -->
+<ref name="b"/>
+== 历史 ==
+* [[几何学|幾何]]的知识&nbsp;&amp;[[代数]]
+# [[#历史|本节]]
+{| class="wikitable"
+|-
+| 表格 || 内容
+|}
+[[File:Euclid.jpg|thumb|[[欧几里得]]的像]]
+[https://example.com 外部链接]和[https://example.com]
+----
+===参见===
+<math>x^2</math>__TOC__<small>小字</small>
+[[Category:数学]]
+[[en:Mathematics]]`
+
+	got := StripWikitext(text)
+	want := "数学是研究数量、结构的学科。\n\n历史\n幾何的知识\u00a0&代数\n本节\n\n外部链接和\n参见\n小字"
+	if got.Text != want {
+		t.Errorf("Text =\n%s\nwant\n%s", got.Text, want)
+	}
+	if want := []string{"历史", "参见"}; !reflect.DeepEqual(got.Headings, want) {
+		t.Errorf("Headings = %v, want %v", got.Headings, want)
+	}
+	if want := []string{"数量", "结构 (数学)", "几何学", "代数"}; !reflect.DeepEqual(got.Links, want) {
+		t.Errorf("Links = %v, want %v", got.Links, want)
+	}
+
+	// 没有闭合的标记不会导致错误
+	if got := StripWikitext("前文{{未闭合[[链接"); got.Text != "前文{{未闭合链接" {
+		t.Errorf("Text of unclosed markup = %q", got.Text)
+	}
+}
+
+func TestStripWikitextUnclosed(t *testing.T) {
+	// 没有闭合的模板和表格不会吞掉其后的正文，其后闭合的部分仍会被去除
+	got := StripWikitext("前文{{未闭合\n正文{{模板}}[[京都]]\n{| 表格\n后文{{Cite web|title=x}}")
+	want := "前文{{未闭合\n正文京都\n{| 表格\n后文"
+	if got.Text != want {
+		t.Errorf("Text = %q, want %q", got.Text, want)
+	}
+	if want := []string{"京都"}; !reflect.DeepEqual(got.Links, want) {
+		t.Errorf("Links = %v, want %v", got.Links, want)
+	}
+}
+
+func TestLoadWikiDumpFields(t *testing.T) {
+	env := newTestEnv()
+	env.RecordWikiFields = true
+	if err := env.LoadWikiDump("../wiki.xml", 100); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := env.Store.GetDocumentID("数学")
+	body, _ := env.Store.GetDocumentBody(id)
+	for _, markup := range []string{"{{", "[[", "<ref", "'''"} {
+		if strings.Contains(body, markup) {
+			t.Errorf("body contains %q", markup)
+		}
+	}
+	metadata, err := env.Store.GetDocumentMetadata(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains("\n"+metadata[MetadataLinks]+"\n", "\n几何学\n") {
+		t.Errorf("links do not contain 几何学: %q", metadata[MetadataLinks])
+	}
+	if !strings.Contains("\n"+metadata[MetadataHeadings]+"\n", "\n历史\n") {
+		t.Errorf("headings do not contain 历史: %q", metadata[MetadataHeadings])
+	}
+	if ids := searchIDs(t, env, "几何学"); len(ids) != 0 {
+		t.Errorf("link target indexed: %v", ids)
+	}
+}
@@ -1,26 +1,26 @@
 package logic
 
 import (
-	"encoding/xml"
 	"fmt"
 	"github.com/read-talk/wiser/dao"
 	"github.com/read-talk/wiser/util"
 	"io"
-	"os"
 )
 
-func NewEnv(v int) *WiserEnv {
+// 创建应用程序运行环境
+// store 存储后端
+// v 缓冲区中文档数的阈值
+func NewEnv(store dao.Store, v int) *WiserEnv {
 	return &WiserEnv{
-		TokenLen:           NGram,            // 词元的长度。NGram中N的取值
-		Compress:           CompressMethod{}, // 压缩倒排列表等数据的方法
-		EnablePharseSearch: 0,                // 是否进行短语检索
-		IIBuffer: &InvertedIndexHash{ // 用于更新倒排索引的缓冲区（Buffer）
-			HashMap: make(map[int]*InvertedIndexValue),
-			Items:   make([]*InvertedIndexValue, 0),
-		},
-		IIBufferCount:           0, // 用户更新倒排索引的缓冲区中的文档数
-		IIBufferUpdateThreshold: v, // 缓冲区中文档数的阈值
-		IndexedCount:            0, // 建立了索引的文档数
+		Store:                   store,                               // 存储文档、词元和倒排列表的后端
+		TokenLen:                NGram,                               // 词元的长度。NGram中N的取值
+		Compress:                CompressMethod{CompressVByte: true}, // 压缩倒排列表等数据的方法
+		EnablePharseSearch:      0,                                   // 是否进行短语检索
+		IIBuffer:                NewInvertedIndexHash(),              // 用于更新倒排索引的缓冲区（Buffer）
+		IIBufferCount:           0,                                   // 用户更新倒排索引的缓冲区中的文档数
+		IIBufferUpdateThreshold: v,                                   // 缓冲区中文档数的阈值
+		IndexedCount:            0,                                   // 建立了索引的文档数
+		Scorer:                  TfIdfScorer{},                       // 计算检索结果得分的方法
 	}
 }
 
@@ -28,84 +28,179 @@ func NewEnv(v int) *WiserEnv {
 // title 文档标题，为 Nil 时将会清空缓冲区
 // body 文档正文
 func (env *WiserEnv) AddDocument(title, body string) error {
+	_, err := env.addDocument(title, body)
+	return err
+}
+
+// 与 AddDocument 相同，返回是否添加或更新了文档
+func (env *WiserEnv) addDocument(title, body string) (bool, error) {
+	// 在存储文档之前同步设置，以便区分新建的索引和已有的索引
+	err := env.syncSettings()
+	if err != nil {
+		return false, err
+	}
 	if len(title) > 0 && len(body) > 0 {
-		// 将文档标题和正文存储到数据库中
-		dao.DBAddDocument(title, body)
-		// 并获取该文档对应的文档编号
-		documentID := dao.DBGetDocumentID(title)
+		// 已删除的文档尚未清除时，先将其清除，再作为新文档添加
+		err = env.purgeDeletedTitle(title)
+		if err != nil {
+			return false, err
+		}
+		// 获取该文档对应的文档编号，标题已存在时更新文档
+		documentID, err := dao.DBGetDocumentID(env.Store, title)
+		if err != nil {
+			return false, err
+		}
+		if documentID != 0 {
+			oldBody, err := env.Store.GetDocumentBody(documentID)
+			if err != nil {
+				return false, err
+			}
+			if oldBody == body {
+				// 正文没有变化时不需要重新建立索引
+				return false, nil
+			}
+			err = env.removeDocumentPostings(documentID, oldBody)
+			if err != nil {
+				return false, err
+			}
+			err = env.Store.UpdateDocument(documentID, body)
+			if err != nil {
+				return false, err
+			}
+		} else {
+			// 将文档标题和正文存储到数据库中
+			err = env.Store.InsertDocument(title, body)
+			if err != nil {
+				return false, err
+			}
+			documentID, err = dao.DBGetDocumentID(env.Store, title)
+			if err != nil {
+				return false, err
+			}
+			env.IndexedCount++ // 建立了索引的文档数
+		}
 
 		// 为文档创建倒排列表
 		// 根据文档编号和文档内容更新存储在变量 env.IIBuffer 中的小倒排索引
-		err := env.TextToPostingsLists(documentID, body)
+		tokenCount, err := env.TextToPostingsLists(documentID, body, env.IIBuffer)
 		if err != nil {
-			return err
+			return false, err
+		}
+		// 记录文档的长度，更新文档时减去原来的长度
+		oldTokenCount, err := env.Store.GetDocumentLength(documentID)
+		if err != nil {
+			return false, err
 		}
+		err = env.Store.UpdateDocumentLength(documentID, tokenCount)
+		if err != nil {
+			return false, err
+		}
+		env.pendingTokenCount += tokenCount - oldTokenCount
+		if env.bufferedDocuments == nil {
+			env.bufferedDocuments = make(map[int]bool)
+		}
+		env.bufferedDocuments[documentID] = true
 		env.IIBufferCount++ // 用户更新在缓冲区中已建立倒排索引的文档数
-		env.IndexedCount++  // 建立了索引的文档数
 		fmt.Printf("count: %d title: %s\n", env.IndexedCount, title)
+		return true, env.flushBufferIfFull(title)
 	}
+	return false, env.flushBufferIfFull(title)
+}
 
-	// 存储在缓冲区中的文档数量达到了指定的阈值时，更新存储器上的倒排索引
-	// 当 title 为空时，或者当已构建出小倒排索引的文档数量达到了阈值时，就合并索引
-	// 另外，title 为空，还标志着所有的文档都已经处理完了。
-	// 阈值设定得越小，内存的使用量也就越小，但会增加堆数据库的访问次数。
-	// 反过来，阅知设定得越大，内存的使用量就越大，也减少了对数据库的访问次数。
-	if len(env.IIBuffer.HashMap) > env.IIBufferUpdateThreshold || title == "" {
-		fmt.Println("开始合并倒排索引")
-		util.PrintTimeDiff()
-		// 更新所有词元对应的倒排项，合并倒排索引，
-		// 并将合并后的结果写入数据库(存储器)中。
-		for _, p := range env.IIBuffer.HashMap {
-			err := env.UpdatePostings(p)
-			if err != nil {
-				return err
-			}
-		}
-		env.IIBuffer = nil
-		env.IIBufferCount = 0
-		util.PrintTimeDiff()
-		fmt.Println("Index flushed合并倒排索引结束")
+// 存储在缓冲区中的文档数量达到了指定的阈值时，更新存储器上的倒排索引
+// 当 title 为空时，或者当已构建出小倒排索引的文档数量达到了阈值时，就合并索引
+// 另外，title 为空，还标志着所有的文档都已经处理完了。
+// 阈值设定得越小，内存的使用量也就越小，但会增加堆数据库的访问次数。
+// 反过来，阅知设定得越大，内存的使用量就越大，也减少了对数据库的访问次数。
+func (env *WiserEnv) flushBufferIfFull(title string) error {
+	if env.IIBufferCount > env.IIBufferUpdateThreshold || title == "" {
+		return env.flushBuffer()
 	}
 	return nil
 }
 
-// 导入 wiki 数据
-func (env *WiserEnv) LoadWikiDump(wikiDumpFile string,m int) error {
-	xmlFile, err := os.Open(wikiDumpFile)
+// 更新文档之前，准备从倒排索引中去除该文档原来的倒排列表
+// 合并倒排索引时，存储器上的倒排列表中的该文档会被去除，再合并新的倒排列表
+// id 文档编号
+// old body 文档原来的正文
+func (env *WiserEnv) removeDocumentPostings(id int, oldBody string) error {
+	// 缓冲区中已有该文档的倒排列表时，先将其写入存储器，避免同一文档的倒排列表重复
+	if env.bufferedDocuments[id] {
+		err := env.flushBuffer()
+		if err != nil {
+			return err
+		}
+	}
+	if env.replacedDocuments == nil {
+		env.replacedDocuments = make(map[int]bool)
+	}
+	env.replacedDocuments[id] = true
+	// 只出现在原来的正文中的词元也要在合并时处理，为其在缓冲区中添加空的倒排列表
+	tokens, err := env.splitQueryToTokens(oldBody)
 	if err != nil {
 		return err
 	}
-	defer xmlFile.Close()
-
-	var cnt int
-	decoder := xml.NewDecoder(xmlFile)
-	for {
-		t, err := decoder.Token()
-		if err == io.EOF {
-			break
+	for _, t := range tokens.Items {
+		if t.TokenID == 0 {
+			continue
+		}
+		if _, ok := env.IIBuffer.HashMap[t.TokenID]; ok {
+			continue
 		}
+		entry := &InvertedIndexValue{TokenID: t.TokenID, PostingsList: NewPostingsList()}
+		env.IIBuffer.HashMap[t.TokenID] = entry
+		env.IIBuffer.Items = append(env.IIBuffer.Items, entry)
+	}
+	return nil
+}
+
+// 将缓冲区中的小倒排索引与存储器上的倒排索引合并
+func (env *WiserEnv) flushBuffer() error {
+	fmt.Println("开始合并倒排索引")
+	util.PrintTimeDiff()
+	// 合并时顺便从倒排列表中清除已删除的文档，以及正文被更新的文档原来的数据
+	deleted, err := env.deletedDocuments()
+	if err != nil {
+		return err
+	}
+	for id := range env.replacedDocuments {
+		deleted[id] = true
+	}
+	// 更新所有词元对应的倒排项，合并倒排索引，
+	// 并将合并后的结果写入数据库(存储器)中。
+	for _, p := range env.IIBuffer.HashMap {
+		err := env.updatePostings(p, deleted)
 		if err != nil {
 			return err
 		}
-		if t == nil {
-			break
-		}
-		switch se := t.(type) {
-		case xml.StartElement:
-			if se.Name.Local == "page" {
-				var p Page
-				err = decoder.DecodeElement(&p, &se)
-				err = env.AddDocument(p.Title, p.Text)
-				if err != nil {
-					fmt.Println("add document failed: ", err)
-					return err
-				}
-				cnt++
-				if cnt > m {
-					break
-				}
-			}
-		}
 	}
+	err = env.addTotalTokenCount(env.pendingTokenCount)
+	if err != nil {
+		return err
+	}
+	env.pendingTokenCount = 0
+	env.IIBuffer = NewInvertedIndexHash()
+	env.IIBufferCount = 0
+	env.bufferedDocuments = nil
+	env.replacedDocuments = nil
+	util.PrintTimeDiff()
+	fmt.Println("Index flushed合并倒排索引结束")
 	return nil
 }
+
+// 导入 wiki 数据
+// wiki dump file 数据文件的路径，可以是 bzip2 或 gzip 压缩的文件，为 - 时从标准输入读取
+// m 最多导入的文档数
+func (env *WiserEnv) LoadWikiDump(wikiDumpFile string, m int) error {
+	xmlFile, err := util.OpenInput(wikiDumpFile)
+	if err != nil {
+		return err
+	}
+	defer xmlFile.Close()
+	return env.LoadWikiDumpReader(xmlFile, m)
+}
+
+// 从 r 中读取并导入 wiki 数据
+func (env *WiserEnv) LoadWikiDumpReader(r io.Reader, m int) error {
+	return env.LoadDocuments(NewWikiSource(env, r), m)
+}
@@ -0,0 +1,239 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/read-talk/wiser/dao"
+)
+
+// 新建使用内存存储的运行环境
+func newTestEnv() *WiserEnv {
+	return NewEnv(dao.NewMemoryStore(), 2048)
+}
+
+// 新建运行环境，并为附带的 wiki.xml 建立索引
+func newWikiEnv(t testing.TB) *WiserEnv {
+	env := newTestEnv()
+	err := env.LoadWikiDump("../wiki.xml", 100)
+	if err != nil {
+		t.Fatalf("LoadWikiDump: %v", err)
+	}
+	return env
+}
+
+// 执行检索并返回按得分降序排列的结果
+func search(t testing.TB, env *WiserEnv, q string) []*SearchResult {
+	query, err := ParseQuery(q)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q): %v", q, err)
+	}
+	results := newTopKResults(0, nil)
+	if err := env.searchDocs(context.Background(), query, env.Scorer, false, results); err != nil {
+		t.Fatalf("searchDocs(%q): %v", q, err)
+	}
+	return results.sorted()
+}
+
+// 将若干文档添加到索引中，并将缓冲区写入存储器
+func addDocuments(t testing.TB, env *WiserEnv, docs ...string) {
+	for i := 0; i+1 < len(docs); i += 2 {
+		if err := env.AddDocument(docs[i], docs[i+1]); err != nil {
+			t.Fatalf("AddDocument(%q): %v", docs[i], err)
+		}
+	}
+	if err := env.AddDocument("", ""); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+}
+
+func TestLoadWikiDump(t *testing.T) {
+	env := newWikiEnv(t)
+	n, err := env.Store.GetDocumentCount()
+	if err != nil || n != 1 {
+		t.Fatalf("GetDocumentCount = %d, %v; want 1", n, err)
+	}
+	if env.IndexedCount != 1 {
+		t.Errorf("IndexedCount = %d, want 1", env.IndexedCount)
+	}
+	id, _ := env.Store.GetDocumentID("数学")
+	if id == 0 {
+		t.Fatal("document 数学 not stored")
+	}
+	tokenID, docsCount, _ := env.Store.GetTokenID("数学")
+	if tokenID == 0 || docsCount != 1 {
+		t.Fatalf("GetTokenID(数学) = %d, %d", tokenID, docsCount)
+	}
+	postings, _, err := env.FetchPostings(tokenID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if postings.Len() != 1 || postings.DocumentIDs[0] != id {
+		t.Fatalf("postings of 数学 = %+v", postings)
+	}
+	if len(postings.DocumentPositions(0)) == 0 {
+		t.Errorf("no positions of 数学")
+	}
+}
+
+func TestSearchWiki(t *testing.T) {
+	env := newWikiEnv(t)
+	for _, q := range []string{"数学", "数学家", "幾何"} {
+		results := search(t, env, q)
+		if len(results) != 1 {
+			t.Errorf("search(%q) found %d documents, want 1", q, len(results))
+			continue
+		}
+		title, _ := env.Store.GetDocumentTitle(results[0].DocumentID)
+		if title != "数学" {
+			t.Errorf("search(%q) = %q, want 数学", q, title)
+		}
+	}
+	if results := search(t, env, "不存在的词"); len(results) != 0 {
+		t.Errorf("search of missing words found %d documents", len(results))
+	}
+}
+
+func TestUpdatePostings(t *testing.T) {
+	env := newTestEnv()
+	addDocuments(t, env, "甲", "东京都的天气", "乙", "京都的寺庙")
+	addDocuments(t, env, "丙", "东京的夜景")
+
+	tokenID, docsCount, _ := env.Store.GetTokenID("京都")
+	if docsCount != 2 {
+		t.Errorf("docs_count of 京都 = %d, want 2", docsCount)
+	}
+	postings, _, err := env.FetchPostings(tokenID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := postings.DocumentIDs
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("documents of 京都 = %v, want [1 2]", ids)
+	}
+
+	tokenID, docsCount, _ = env.Store.GetTokenID("东京")
+	if docsCount != 2 {
+		t.Errorf("docs_count of 东京 = %d, want 2", docsCount)
+	}
+	postings, _, _ = env.FetchPostings(tokenID)
+	if postings.Len() != 2 || postings.DocumentIDs[1] != 3 {
+		t.Errorf("postings of 东京 not merged across flushes")
+	}
+}
+
+// 以便于比较的形式获取整个索引的内容
+// 键为词元，值为文档数以及各文档的标题和出现位置，倒排列表为空的词元不包含在内
+func dumpIndex(t testing.TB, env *WiserEnv) map[string]string {
+	ids, err := env.Store.GetTokenIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := make(map[string]string)
+	for _, id := range ids {
+		token, _ := env.Store.GetToken(id)
+		_, docsCount, _ := env.Store.GetTokenID(token)
+		postings, _, err := env.FetchPostings(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if postings.Len() == 0 && docsCount == 0 {
+			continue
+		}
+		s := fmt.Sprint(docsCount)
+		for i := 0; i < postings.Len(); i++ {
+			title, _ := env.Store.GetDocumentTitle(postings.DocumentIDs[i])
+			s += fmt.Sprintf(" %s%v", title, postings.DocumentPositions(i))
+		}
+		index[token] = s
+	}
+	index["#documents"] = fmt.Sprint(env.IndexedCount)
+	index["#tokens"], _ = env.Store.GetSettings(SettingTotalTokenCount)
+	return index
+}
+
+func TestReimportWikiDump(t *testing.T) {
+	env := newWikiEnv(t)
+	want := dumpIndex(t, env)
+	for i := 0; i < 2; i++ {
+		if err := env.LoadWikiDump("../wiki.xml", 100); err != nil {
+			t.Fatal(err)
+		}
+		if got := dumpIndex(t, env); !reflect.DeepEqual(got, want) {
+			t.Fatalf("index changed after importing again:\n%v\nwant\n%v", got, want)
+		}
+	}
+}
+
+func TestUpdateDocument(t *testing.T) {
+	env := newTestEnv()
+	addDocuments(t, env, "甲", "东京都的天气", "乙", "京都的寺庙", "丙", "东京的夜景")
+	// 更新已写入存储器的文档，其中的乙在同一个缓冲区中更新了两次
+	addDocuments(t, env, "甲", "大阪府的天气", "乙", "大阪的寺庙", "乙", "京都的神社", "丙", "东京的夜景")
+
+	want := newTestEnv()
+	addDocuments(t, want, "甲", "大阪府的天气", "乙", "京都的神社", "丙", "东京的夜景")
+	if got, want := dumpIndex(t, env), dumpIndex(t, want); !reflect.DeepEqual(got, want) {
+		t.Fatalf("index after update:\n%v\nwant\n%v", got, want)
+	}
+	if ids := searchIDs(t, env, "东京"); !reflect.DeepEqual(ids, []int{3}) {
+		t.Errorf("search(东京) = %v, want [3]", ids)
+	}
+	if ids := searchIDs(t, env, "寺庙"); len(ids) != 0 {
+		t.Errorf("search(寺庙) = %v, want none", ids)
+	}
+
+	// 在缓冲区写入存储器之前更新新添加的文档
+	env = newTestEnv()
+	addDocuments(t, env, "甲", "东京都的天气", "乙", "京都的寺庙", "乙", "京都的神社", "甲", "大阪府的天气", "丙", "东京的夜景")
+	if got, want := dumpIndex(t, env), dumpIndex(t, want); !reflect.DeepEqual(got, want) {
+		t.Fatalf("index after update in buffer:\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	env := newTestEnv()
+	addDocuments(t, env,
+		"甲", "东京都的天气",
+		"乙", "京都的寺庙",
+		"丙", "东京的夜景，东京的美食")
+	env.IndexedCount = 3
+
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"京都", []int{1, 2}},
+		{"东京", []int{3, 1}},
+		{"东京都", []int{1}},
+		{"大阪", nil},
+	}
+	for _, tt := range tests {
+		results := search(t, env, tt.query)
+		var got []int
+		for _, r := range results {
+			got = append(got, r.DocumentID)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("search(%q) = %v, want %v", tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("search(%q) = %v, want %v", tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestMergePostings(t *testing.T) {
+	docs := map[int][]int{1: {0}, 2: {1, 2}, 4: {3}, 5: {4, 5, 6}}
+	got := MergePostings(makePostings(docs, 1, 4), makePostings(docs, 2, 5))
+	want := makePostings(docs, 1, 2, 4, 5)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("MergePostings = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,186 @@
+package util
+
+import "errors"
+
+var ErrShortBuffer = errors.New("unexpected end of bit stream")
+
+// 按位写入的缓冲区，高位在前
+type BitWriter struct {
+	buf   []byte
+	nbits uint // 最后一个字节中已经写入的位数
+}
+
+// 写入 1 位
+func (w *BitWriter) WriteBit(bit bool) {
+	if w.nbits == 0 {
+		w.buf = append(w.buf, 0)
+	}
+	if bit {
+		w.buf[len(w.buf)-1] |= 0x80 >> w.nbits
+	}
+	w.nbits = (w.nbits + 1) % 8
+}
+
+// 写入 v 的低 n 位
+func (w *BitWriter) WriteBits(v uint64, n uint) {
+	for ; n > 0; n-- {
+		w.WriteBit(v&(1<<(n-1)) != 0)
+	}
+}
+
+// 用一元编码写入 v：v 个 1 之后跟 1 个 0
+func (w *BitWriter) WriteUnary(v uint64) {
+	for ; v > 0; v-- {
+		w.WriteBit(true)
+	}
+	w.WriteBit(false)
+}
+
+// 用 Elias gamma 编码写入 v，v 必须大于 0
+func (w *BitWriter) WriteGamma(v uint64) {
+	n := bitLen(v)
+	w.WriteBits(0, n-1)
+	w.WriteBits(v, n)
+}
+
+// 以 m 为参数用 Golomb 编码写入 v
+func (w *BitWriter) WriteGolomb(v, m uint64) {
+	w.WriteUnary(v / m)
+	r := v % m
+	b := bitLen(m - 1)
+	// 余数使用截断二进制编码
+	u := uint64(1)<<b - m
+	if r < u {
+		w.WriteBits(r, b-1)
+	} else {
+		w.WriteBits(r+u, b)
+	}
+}
+
+// 返回写入的内容，不足一个字节的部分用 0 填充
+func (w *BitWriter) Bytes() []byte {
+	return w.buf
+}
+
+// 按位读取的缓冲区，高位在前
+type BitReader struct {
+	buf []byte
+	pos uint // 下一个要读取的位
+}
+
+func NewBitReader(buf []byte) *BitReader {
+	return &BitReader{buf: buf}
+}
+
+// 读取 1 位
+func (r *BitReader) ReadBit() (bool, error) {
+	i := r.pos / 8
+	if i >= uint(len(r.buf)) {
+		return false, ErrShortBuffer
+	}
+	bit := r.buf[i]&(0x80>>(r.pos%8)) != 0
+	r.pos++
+	return bit, nil
+}
+
+// 读取 n 位
+func (r *BitReader) ReadBits(n uint) (uint64, error) {
+	var v uint64
+	for ; n > 0; n-- {
+		bit, err := r.ReadBit()
+		if err != nil {
+			return 0, err
+		}
+		v <<= 1
+		if bit {
+			v |= 1
+		}
+	}
+	return v, nil
+}
+
+// 读取一元编码的值
+func (r *BitReader) ReadUnary() (uint64, error) {
+	var v uint64
+	for {
+		bit, err := r.ReadBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			return v, nil
+		}
+		v++
+	}
+}
+
+// 读取 Elias gamma 编码的值
+func (r *BitReader) ReadGamma() (uint64, error) {
+	var n uint
+	for {
+		bit, err := r.ReadBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit {
+			break
+		}
+		n++
+	}
+	if n > 63 {
+		return 0, errors.New("gamma code overflow")
+	}
+	v, err := r.ReadBits(n)
+	if err != nil {
+		return 0, err
+	}
+	return 1<<n | v, nil
+}
+
+// 读取以 m 为参数的 Golomb 编码的值
+func (r *BitReader) ReadGolomb(m uint64) (uint64, error) {
+	q, err := r.ReadUnary()
+	if err != nil {
+		return 0, err
+	}
+	b := bitLen(m - 1)
+	u := uint64(1)<<b - m
+	var v uint64
+	if b > 0 {
+		v, err = r.ReadBits(b - 1)
+		if err != nil {
+			return 0, err
+		}
+		if v >= u {
+			bit, err := r.ReadBit()
+			if err != nil {
+				return 0, err
+			}
+			v <<= 1
+			if bit {
+				v |= 1
+			}
+			v -= u
+		}
+	}
+	return q*m + v, nil
+}
+
+// 根据平均间隔计算 Golomb 编码的参数
+// 对于服从几何分布的间隔，参数取平均间隔的 0.69 倍左右时编码长度最短
+func GolombParameter(avgGap float64) uint64 {
+	m := uint64(avgGap*0.69 + 0.5)
+	if m < 1 {
+		return 1
+	}
+	return m
+}
+
+// 表示 v 所需的位数
+func bitLen(v uint64) uint {
+	var n uint
+	for ; v > 0; v >>= 1 {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,93 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBitsRoundTrip(t *testing.T) {
+	tests := []struct {
+		v uint64
+		n uint
+	}{
+		{0, 1}, {1, 1}, {0, 7}, {0x7f, 7}, {0x1ff, 9}, {0xabc, 12}, {1<<63 | 1, 64},
+	}
+	w := &BitWriter{}
+	for _, tt := range tests {
+		w.WriteBits(tt.v, tt.n)
+	}
+	r := NewBitReader(w.Bytes())
+	for _, tt := range tests {
+		if got, err := r.ReadBits(tt.n); err != nil || got != tt.v {
+			t.Errorf("ReadBits(%d) = %#x, %v, want %#x", tt.n, got, err, tt.v)
+		}
+	}
+}
+
+func TestUnaryGammaRoundTrip(t *testing.T) {
+	// 7 和 8 位的值使编码跨越字节边界
+	values := []uint64{1, 2, 3, 7, 8, 9, 255, 256, 1 << 20, 1<<63 + 5}
+	w := &BitWriter{}
+	for _, v := range values {
+		w.WriteUnary(v % 20)
+		w.WriteGamma(v)
+	}
+	r := NewBitReader(w.Bytes())
+	for _, v := range values {
+		if got, err := r.ReadUnary(); err != nil || got != v%20 {
+			t.Errorf("ReadUnary = %d, %v, want %d", got, err, v%20)
+		}
+		if got, err := r.ReadGamma(); err != nil || got != v {
+			t.Errorf("ReadGamma = %d, %v, want %d", got, err, v)
+		}
+	}
+}
+
+func TestGolombRoundTrip(t *testing.T) {
+	for _, m := range []uint64{1, 2, 3, 5, 8, 69, 1000} {
+		// 0、1、各个余数的边界以及相对于 m 很大的值
+		values := []uint64{0, 1, m - 1, m, m + 1, 2*m - 1, 7, 8, 255, 256, 5000}
+		w := &BitWriter{}
+		for _, v := range values {
+			w.WriteGolomb(v, m)
+		}
+		r := NewBitReader(w.Bytes())
+		var got []uint64
+		for range values {
+			v, err := r.ReadGolomb(m)
+			if err != nil {
+				t.Fatalf("m=%d: ReadGolomb: %v", m, err)
+			}
+			got = append(got, v)
+		}
+		if !reflect.DeepEqual(got, values) {
+			t.Errorf("m=%d: ReadGolomb = %v, want %v", m, got, values)
+		}
+	}
+}
+
+func TestBitReaderShortBuffer(t *testing.T) {
+	w := &BitWriter{}
+	w.WriteGolomb(100, 3)
+	buf := w.Bytes()
+	if _, err := NewBitReader(buf[:len(buf)-1]).ReadGolomb(3); err != ErrShortBuffer {
+		t.Errorf("ReadGolomb of truncated buffer = %v, want ErrShortBuffer", err)
+	}
+	if _, err := NewBitReader(nil).ReadBit(); err != ErrShortBuffer {
+		t.Errorf("ReadBit of empty buffer = %v, want ErrShortBuffer", err)
+	}
+}
+
+func TestGolombParameter(t *testing.T) {
+	tests := []struct {
+		avgGap float64
+		want   uint64
+	}{
+		{0, 1}, {0.5, 1}, {1, 1}, {10, 7}, {100, 69},
+	}
+	for _, tt := range tests {
+		if got := GolombParameter(tt.avgGap); got != tt.want {
+			t.Errorf("GolombParameter(%v) = %d, want %d", tt.avgGap, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+)
+
+// 打开要导入的文件，压缩的文件在读取时解压缩
+// 根据扩展名（.gz、.bz2）或文件开头的魔数判断压缩格式，不需要先将文件解压缩到磁盘上。
+// path 文件的路径，为 - 时从标准输入读取
+func OpenInput(path string) (io.ReadCloser, error) {
+	var f io.ReadCloser
+	if path == "-" {
+		f = ioutil.NopCloser(os.Stdin)
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		f = file
+	}
+	r, err := decompress(bufio.NewReader(f), strings.ToLower(path))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &inputReader{Reader: r, closer: f}, nil
+}
+
+// 读取解压缩后的数据，关闭时关闭原来的文件
+type inputReader struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (r *inputReader) Close() error {
+	if c, ok := r.Reader.(io.Closer); ok {
+		c.Close()
+	}
+	return r.closer.Close()
+}
+
+// 根据扩展名或魔数选择解压缩的方法，不是压缩文件时原样返回
+func decompress(r *bufio.Reader, name string) (io.Reader, error) {
+	magic, _ := r.Peek(4)
+	switch {
+	case strings.HasSuffix(name, ".gz") || bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(r)
+	case strings.HasSuffix(name, ".bz2") ||
+		// bzip2 的魔数之后是 1 到 9 的块大小
+		bytes.HasPrefix(magic, bzip2Magic) && len(magic) == 4 && magic[3] >= '1' && magic[3] <= '9':
+		return bzip2.NewReader(r), nil
+	default:
+		return r, nil
+	}
+}
@@ -3,11 +3,14 @@ package util
 import (
 	"fmt"
 	"time"
+	"unicode"
 )
 
 // 检查输入的字符（UTF-32）是否不属于索引对象
 // ustr 输入的字符
 // 返回是否是空白字符 true: 是空白字符，false: 不是空白字符
+// 旧的 ngram 分析器创建的索引依赖于该函数的结果，修改后查询与索引中的词元将不再一致，
+// 因此该函数保持不变，新的分析器使用 IsSeparatorChar
 func IsIgnoredChar(c rune) bool {
 	switch c {
 	case ' ', '\f', '\n', '\r', '\t',
@@ -32,12 +35,24 @@ func IsIgnoredChar(c rune) bool {
 	}
 }
 
+// 检查输入的字符（UTF-32）是否是分隔符
+// 根据 Unicode 的字符类别判断，空白、标点、符号以及控制字符和格式字符都是分隔符
+// 与 IsIgnoredChar 不同，字母和数字都属于索引对象
+func IsSeparatorChar(c rune) bool {
+	return unicode.IsSpace(c) || unicode.In(c, unicode.P, unicode.S, unicode.Z, unicode.Cc, unicode.Cf)
+}
+
 // 将输入的字符串分隔为N-gram
 // ustr 输入的字符串
 // n N-gram 中 N 的取值。建议将其设为大于 1 的值
 // start 词元的起始位置
 // 返回分隔出来的词元的长度
 func NgramNext(ustr []rune, start *int, n int) (int, int) {
+	return NgramNextFunc(ustr, start, n, IsIgnoredChar)
+}
+
+// 与 NgramNext 相同，以 ignored 判断字符是否属于索引对象
+func NgramNextFunc(ustr []rune, start *int, n int, ignored func(c rune) bool) (int, int) {
 	totalLen := len(ustr)
 	// 读取时跳过文本开头的空格等字符
 	for {
@@ -45,7 +60,7 @@ func NgramNext(ustr []rune, start *int, n int) (int, int) {
 			break
 		}
 		// 当不是空白字符的时候就跳出循环
-		if !IsIgnoredChar(ustr[*start]) {
+		if !ignored(ustr[*start]) {
 			break
 		}
 		*start++
@@ -62,7 +77,7 @@ func NgramNext(ustr []rune, start *int, n int) (int, int) {
 			break
 		}
 		// 当是空白字符的时候就结束索引
-		if IsIgnoredChar(ustr[*start]) {
+		if ignored(ustr[*start]) {
 			break
 		}
 		*start++
@@ -0,0 +1,34 @@
+package util
+
+import (
+	"testing"
+	"unicode"
+)
+
+func isASCIIAlnum(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func TestIgnoredAndSeparatorChar(t *testing.T) {
+	ignored := 0
+	for c := rune(0); c <= unicode.MaxRune; c++ {
+		if !IsIgnoredChar(c) {
+			continue
+		}
+		ignored++
+		// IsIgnoredChar 只在半角字母和数字上与 IsSeparatorChar 不同
+		if isASCIIAlnum(c) == IsSeparatorChar(c) {
+			t.Errorf("IsIgnoredChar(%q) = true, IsSeparatorChar = %v", c, IsSeparatorChar(c))
+		}
+	}
+	// 空白 5 个、半角标点 32 个、全角标点 10 个、字母 52 个、数字 10 个
+	if ignored != 109 {
+		t.Errorf("IsIgnoredChar matches %d characters, want 109", ignored)
+	}
+	// IsIgnoredChar 的列表之外的分隔符
+	for _, c := range []rune{'\v', '\u3000', '《', '》', '—', '·', '「', '」', '\u200b'} {
+		if IsIgnoredChar(c) || !IsSeparatorChar(c) {
+			t.Errorf("IsIgnoredChar(%q) = %v, IsSeparatorChar = %v, want false, true", c, IsIgnoredChar(c), IsSeparatorChar(c))
+		}
+	}
+}